@@ -0,0 +1,323 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// maximumIncludeDepth mirrors the limit APT places on nested #include
+// directives (ReadConfigFile fails beyond a depth of 10), so that include
+// cycles fail instead of recursing forever.
+const maximumIncludeDepth = 10
+
+type aptconfTokenKind int
+
+const (
+	aptconfWord aptconfTokenKind = iota
+	aptconfOpen
+	aptconfClose
+	aptconfTerminator
+	aptconfDirective
+)
+
+type aptconfToken struct {
+	kind aptconfTokenKind
+	text string
+	line int
+}
+
+type aptconfParser struct {
+	cfg   Configuration
+	name  string
+	depth int
+}
+
+// ParseAPTConf parses the apt.conf(5) syntax read from reader into a new
+// [Configuration].
+//
+// Scopes are flattened into the same "A::B::C" keys that APT sends in its 601
+// Configuration message, so that the result can be used interchangeably with
+// the configuration received by a [Method]:
+//
+//	Acquire {
+//	  s3::Timeout "30";
+//	  Languages { "en"; "de"; };
+//	};
+//
+// becomes Acquire::s3::Timeout and the list entries Acquire::Languages::.
+// Comments (//, /* */ and #), quoted strings, list values, #include and
+// #clear are supported. Relative paths given to #include are resolved against
+// the current working directory, exactly as APT does.
+func ParseAPTConf(reader io.Reader) (Configuration, error) {
+	parser := &aptconfParser{cfg: Configuration{}, name: "apt.conf"}
+	if err := parser.parse(reader); err != nil {
+		return nil, err
+	}
+	return parser.cfg, nil
+}
+
+// LoadAPTConfFile parses the apt.conf(5) file found at path. See
+// [ParseAPTConf] for details.
+func LoadAPTConfFile(path string) (Configuration, error) {
+	parser := &aptconfParser{cfg: Configuration{}}
+	if err := parser.include(path); err != nil {
+		return nil, err
+	}
+	return parser.cfg, nil
+}
+
+// LoadAPTConfDir parses every file in dir the same way APT reads
+// /etc/apt/apt.conf.d. Files are read in lexical order, with later files
+// overriding settings from earlier ones. Only files without an extension, or
+// with the ".conf" extension, whose names are made up of alphanumerics, '_',
+// '-' and '.' are read. All other files are silently skipped.
+func LoadAPTConfDir(dir string) (Configuration, error) {
+	parser := &aptconfParser{cfg: Configuration{}}
+	if err := parser.includeDir(dir); err != nil {
+		return nil, err
+	}
+	return parser.cfg, nil
+}
+
+func (parser *aptconfParser) include(path string) error {
+	if parser.depth >= maximumIncludeDepth {
+		return fmt.Errorf("%w: %s: too many nested includes", ErrAPTConfSyntax, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return parser.includeDir(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	nested := &aptconfParser{cfg: parser.cfg, name: path, depth: parser.depth + 1}
+	return nested.parse(file)
+}
+
+func (parser *aptconfParser) includeDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && isAPTConfFileName(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := parser.include(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isAPTConfFileName(name string) bool {
+	for _, character := range name {
+		switch {
+		case 'a' <= character && character <= 'z':
+		case 'A' <= character && character <= 'Z':
+		case '0' <= character && character <= '9':
+		case character == '_', character == '-', character == '.':
+		default:
+			return false
+		}
+	}
+	return !strings.Contains(name, ".") || strings.HasSuffix(name, ".conf")
+}
+
+func (parser *aptconfParser) parse(reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	tokens, err := parser.tokenize(string(data))
+	if err != nil {
+		return err
+	}
+	scopes := []string{}
+	statement := []aptconfToken{}
+	scope := func() string {
+		if len(scopes) == 0 {
+			return ""
+		}
+		return scopes[len(scopes)-1]
+	}
+	for index := 0; index < len(tokens); index++ {
+		token := tokens[index]
+		switch token.kind {
+		case aptconfWord:
+			statement = append(statement, token)
+		case aptconfOpen:
+			if len(statement) == 0 || len(statement) > 2 {
+				return parser.errorf(token.line, "malformed scope")
+			}
+			key := joinConfigurationKey(scope(), statement[0].text)
+			if len(statement) == 2 {
+				parser.cfg.add(key, statement[1].text)
+			}
+			scopes = append(scopes, key)
+			statement = statement[:0]
+		case aptconfClose:
+			if len(statement) != 0 {
+				return parser.errorf(token.line, "missing ';' before '}'")
+			}
+			if len(scopes) == 0 {
+				return parser.errorf(token.line, "unexpected '}'")
+			}
+			scopes = scopes[:len(scopes)-1]
+		case aptconfTerminator:
+			switch len(statement) {
+			case 0:
+				// Allowed, as blocks are usually closed with "};"
+			case 1:
+				if scope() == "" {
+					return parser.errorf(token.line, "list value %q has no parent", statement[0].text)
+				}
+				parser.cfg.add(scope()+"::", statement[0].text)
+			case 2:
+				parser.cfg.add(joinConfigurationKey(scope(), statement[0].text), statement[1].text)
+			default:
+				return parser.errorf(token.line, "too many words in statement")
+			}
+			statement = statement[:0]
+		case aptconfDirective:
+			arguments := []string{}
+			for index++; index < len(tokens) && tokens[index].kind == aptconfWord; index++ {
+				arguments = append(arguments, tokens[index].text)
+			}
+			if index >= len(tokens) || tokens[index].kind != aptconfTerminator {
+				return parser.errorf(token.line, "missing ';' after %s", token.text)
+			}
+			if err := parser.directive(token, arguments); err != nil {
+				return err
+			}
+		}
+	}
+	if len(statement) != 0 {
+		return parser.errorf(statement[0].line, "missing ';' at end of file")
+	}
+	if len(scopes) != 0 {
+		return parser.errorf(tokens[len(tokens)-1].line, "missing '}' at end of file")
+	}
+	return nil
+}
+
+func (parser *aptconfParser) directive(token aptconfToken, arguments []string) error {
+	if len(arguments) == 0 {
+		return parser.errorf(token.line, "%s requires an argument", token.text)
+	}
+	switch token.text {
+	case "#include":
+		for _, path := range arguments {
+			if err := parser.include(path); err != nil {
+				return err
+			}
+		}
+	case "#clear":
+		for _, key := range arguments {
+			parser.cfg.clear(key)
+		}
+	}
+	return nil
+}
+
+// tokenize splits apt.conf text into words, braces, terminators and
+// directives. Comments are discarded. Quoted and unquoted parts that are not
+// separated by whitespace are joined into a single word, as APT does.
+func (parser *aptconfParser) tokenize(text string) ([]aptconfToken, error) {
+	tokens := []aptconfToken{}
+	line := 1
+	word := strings.Builder{}
+	inWord := false
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, aptconfToken{kind: aptconfWord, text: word.String(), line: line})
+			word.Reset()
+			inWord = false
+		}
+	}
+	for index := 0; index < len(text); index++ {
+		character := text[index]
+		switch {
+		case character == '\n':
+			flush()
+			line++
+		case character == ' ', character == '\t', character == '\r':
+			flush()
+		case character == '"':
+			end := strings.IndexByte(text[index+1:], '"')
+			if end < 0 {
+				return nil, parser.errorf(line, "unterminated quote")
+			}
+			quoted := text[index+1 : index+1+end]
+			line += strings.Count(quoted, "\n")
+			word.WriteString(quoted)
+			inWord = true
+			index += end + 1
+		case strings.HasPrefix(text[index:], "//"):
+			flush()
+			if end := strings.IndexByte(text[index:], '\n'); end >= 0 {
+				index += end - 1
+			} else {
+				index = len(text)
+			}
+		case strings.HasPrefix(text[index:], "/*"):
+			flush()
+			end := strings.Index(text[index+2:], "*/")
+			if end < 0 {
+				return nil, parser.errorf(line, "unterminated comment")
+			}
+			line += strings.Count(text[index:index+2+end], "\n")
+			index += end + 3
+		case character == '#' && !inWord:
+			if directive, ok := aptconfDirectiveAt(text[index:]); ok {
+				tokens = append(tokens, aptconfToken{kind: aptconfDirective, text: directive, line: line})
+				index += len(directive) - 1
+			} else if end := strings.IndexByte(text[index:], '\n'); end >= 0 {
+				index += end - 1
+			} else {
+				index = len(text)
+			}
+		case character == '{':
+			flush()
+			tokens = append(tokens, aptconfToken{kind: aptconfOpen, text: "{", line: line})
+		case character == '}':
+			flush()
+			tokens = append(tokens, aptconfToken{kind: aptconfClose, text: "}", line: line})
+		case character == ';':
+			flush()
+			tokens = append(tokens, aptconfToken{kind: aptconfTerminator, text: ";", line: line})
+		default:
+			word.WriteByte(character)
+			inWord = true
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+func aptconfDirectiveAt(text string) (string, bool) {
+	for _, directive := range []string{"#include", "#clear"} {
+		rest, ok := strings.CutPrefix(text, directive)
+		if ok && (rest == "" || strings.ContainsAny(rest[:1], " \t")) {
+			return directive, true
+		}
+	}
+	return "", false
+}
+
+func (parser *aptconfParser) errorf(line int, format string, args ...any) error {
+	return fmt.Errorf("%w %s:%d: %s", ErrAPTConfSyntax, parser.name, line, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type APTConfSuite struct {
+	suite.Suite
+}
+
+func (suite *APTConfSuite) TestParseAPTConf() {
+	cfg, err := ParseAPTConf(strings.NewReader(heredoc.Doc(`
+    // Comments are ignored
+    APT {
+      Install-Recommends "false"; # so are these
+      Get {
+        Assume-Yes "true";
+      };
+    };
+    /* including
+       block comments */
+    Acquire::http::User-Agent "apt; with {special} characters";
+    Acquire::Languages { "en"; "de"; };
+    Acquire::Languages:: "fr";
+    Dir::Etc::netrc auth.conf;
+  `)))
+	suite.Require().NoError(err)
+	suite.Equal("false", cfg.Get("APT::Install-Recommends"))
+	suite.Equal("true", cfg.Section("APT::Get").Get("Assume-Yes"))
+	suite.Equal("apt; with {special} characters", cfg.Get("Acquire::http::User-Agent"))
+	suite.Equal([]string{"en", "de", "fr"}, cfg.List("Acquire::Languages"))
+	suite.Equal("auth.conf", cfg.Get("Dir::Etc::netrc"))
+}
+
+func (suite *APTConfSuite) TestParseAPTConfClear() {
+	cfg, err := ParseAPTConf(strings.NewReader(heredoc.Doc(`
+    Acquire::s3::Timeout "30";
+    Acquire::s3::Region "us-east-1";
+    Acquire::s3-other::Region "us-west-2";
+    #clear Acquire::s3;
+  `)))
+	suite.Require().NoError(err)
+	suite.NotContains(cfg, "Acquire::s3::Timeout")
+	suite.NotContains(cfg, "Acquire::s3::Region")
+	suite.Contains(cfg, "Acquire::s3-other::Region")
+}
+
+func (suite *APTConfSuite) TestParseAPTConfInclude() {
+	dir := suite.T().TempDir()
+	path := filepath.Join(dir, "included.conf")
+	suite.Require().NoError(os.WriteFile(path, []byte(`Acquire::s3::Region "eu-west-1";`), 0o644))
+	cfg, err := ParseAPTConf(strings.NewReader(`#include "` + path + `";`))
+	suite.Require().NoError(err)
+	suite.Equal("eu-west-1", cfg.Get("Acquire::s3::Region"))
+
+	cycle := filepath.Join(dir, "cycle.conf")
+	suite.Require().NoError(os.WriteFile(cycle, []byte(`#include "`+cycle+`";`), 0o644))
+	_, err = ParseAPTConf(strings.NewReader(`#include "` + cycle + `";`))
+	suite.ErrorIs(err, ErrAPTConfSyntax)
+}
+
+func (suite *APTConfSuite) TestParseAPTConfErrors() {
+	for _, text := range []string{
+		`APT::Get::Assume-Yes "true"`,
+		`APT { Get "true"; `,
+		`APT "true"; };`,
+		`APT "unterminated;`,
+		`"orphan";`,
+		`/* unterminated`,
+	} {
+		_, err := ParseAPTConf(strings.NewReader(text))
+		suite.ErrorIsf(err, ErrAPTConfSyntax, "input: %s", text)
+	}
+}
+
+func (suite *APTConfSuite) TestLoadAPTConfDir() {
+	cfg, err := LoadAPTConfDir("testdata/apt.conf.d")
+	suite.Require().NoError(err)
+	suite.Equal("120", cfg.Get("Acquire::s3::Timeout"))
+	suite.Equal("us-east-1", cfg.Get("Acquire::s3::Region"))
+	suite.NotContains(cfg, "Acquire::http::Proxy")
+}
+
+func TestAPTConf(test *testing.T) {
+	suite.Run(test, new(APTConfSuite))
+}
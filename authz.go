@@ -1,5 +1,11 @@
 package transport
 
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
 // AuthorizationRequired (status code 402) is sent to APT to request credentials.
 //
 // The transport method requires a User and Password pair to continue. After
@@ -20,3 +26,139 @@ type AuthorizationCredentials struct {
 	User     string
 	Site     string
 }
+
+func (required *AuthorizationRequired) MarshalMessage() (*Message, error) {
+	fields, err := MarshalFields(required)
+	if err != nil {
+		return nil, err
+	}
+	message := &Message{
+		StatusCode: StatusCodeAuthorizationRequired,
+		Summary:    "Authorization Required",
+		Fields:     fields,
+	}
+	return message, nil
+}
+
+func (credentials *AuthorizationCredentials) UnmarshalMessage(message *Message) error {
+	if message.StatusCode != StatusCodeAuthorizationCredentials {
+		return fmt.Errorf("%w: expected %q, received %q", ErrUnexpectedMessage, StatusText(StatusCodeAuthorizationCredentials), StatusText(message.StatusCode))
+	}
+	return UnmarshalFields(message.Fields, credentials)
+}
+
+// RequestCredentials asks APT for the user and password to use for site, and
+// waits for the 602 Authorization Credentials reply. APT looks the site up in
+// its auth.conf, and may prompt the user.
+//
+// Handlers asking for the same site while a request is outstanding share
+// APT's reply, while requests for different sites may be outstanding at the
+// same time. If the credentials are rejected, calling RequestCredentials
+// again sends a new request to APT.
+//
+// If APT replies without a user or password, the reply is returned together
+// with [ErrCredentialsNotProvided].
+func (writer *MessageWriter) RequestCredentials(ctx context.Context, site string) (AuthorizationCredentials, error) {
+	if writer.authorization == nil {
+		return AuthorizationCredentials{}, ErrNoMethod
+	}
+	return writer.authorization.request(ctx, writer, site)
+}
+
+// authorizationBroker routes 602 Authorization Credentials replies to the
+// handlers waiting for them, by site.
+type authorizationBroker struct {
+	mutex     sync.Mutex
+	pending   map[string]*pendingCredentials
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type pendingCredentials struct {
+	credentials AuthorizationCredentials
+	err         error
+	replied     chan struct{}
+}
+
+func newAuthorizationBroker() *authorizationBroker {
+	return &authorizationBroker{
+		pending: map[string]*pendingCredentials{},
+		done:    make(chan struct{}),
+	}
+}
+
+func (broker *authorizationBroker) request(ctx context.Context, writer *MessageWriter, site string) (AuthorizationCredentials, error) {
+	pending, err := broker.await(writer, site)
+	if err != nil {
+		return AuthorizationCredentials{}, err
+	}
+	select {
+	case <-pending.replied:
+	case <-broker.done:
+		return AuthorizationCredentials{}, ErrMethodShutdown
+	case <-ctx.Done():
+		return AuthorizationCredentials{}, ctx.Err()
+	}
+	if pending.err != nil {
+		return AuthorizationCredentials{}, pending.err
+	}
+	credentials := pending.credentials
+	if credentials.User == "" && credentials.Password == "" {
+		return credentials, fmt.Errorf("%w for %q", ErrCredentialsNotProvided, site)
+	}
+	return credentials, nil
+}
+
+// await returns the outstanding request for site, sending a 402 Authorization
+// Required if there is none. The message is written without holding the
+// mutex, as writing may wait for a media change, which in turn needs the
+// main loop to keep delivering replies.
+func (broker *authorizationBroker) await(writer *MessageWriter, site string) (*pendingCredentials, error) {
+	broker.mutex.Lock()
+	pending, ok := broker.pending[site]
+	if !ok {
+		pending = &pendingCredentials{replied: make(chan struct{})}
+		broker.pending[site] = pending
+	}
+	broker.mutex.Unlock()
+	if ok {
+		return pending, nil
+	}
+	message, err := MarshalMessage(&AuthorizationRequired{Site: site})
+	if err == nil {
+		err = writer.Write(message)
+	}
+	if err != nil {
+		broker.mutex.Lock()
+		defer broker.mutex.Unlock()
+		if broker.pending[site] == pending {
+			delete(broker.pending, site)
+			pending.err = err
+			close(pending.replied)
+		}
+		return nil, err
+	}
+	writer.metrics.recordPrompt("authorization")
+	return pending, nil
+}
+
+// deliver hands a 602 Authorization Credentials to the handlers waiting for
+// its site. It reports whether any request for the site was outstanding.
+func (broker *authorizationBroker) deliver(credentials AuthorizationCredentials) bool {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	pending, ok := broker.pending[credentials.Site]
+	if !ok {
+		return false
+	}
+	delete(broker.pending, credentials.Site)
+	pending.credentials = credentials
+	close(pending.replied)
+	return true
+}
+
+// close makes every outstanding and future request fail with
+// [ErrMethodShutdown].
+func (broker *authorizationBroker) close() {
+	broker.closeOnce.Do(func() { close(broker.done) })
+}
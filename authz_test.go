@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AuthorizationSuite struct {
+	suite.Suite
+}
+
+func (suite *AuthorizationSuite) next(recorder messageRecorder) string {
+	select {
+	case message := <-recorder:
+		return message
+	case <-time.After(time.Second):
+		suite.FailNow("no message was sent")
+		return ""
+	}
+}
+
+func (suite *AuthorizationSuite) none(recorder messageRecorder) {
+	select {
+	case message := <-recorder:
+		suite.FailNowf("unexpected message was sent", "%s", message)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+type credentialsResult struct {
+	credentials AuthorizationCredentials
+	err         error
+}
+
+func (suite *AuthorizationSuite) request(writer *MessageWriter, site string) <-chan credentialsResult {
+	result := make(chan credentialsResult, 1)
+	go func() {
+		credentials, err := writer.RequestCredentials(context.Background(), site)
+		result <- credentialsResult{credentials, err}
+	}()
+	return result
+}
+
+func (suite *AuthorizationSuite) TestRequestCredentials() {
+	method, recorder := newRecordedMethod(suite.T())
+	writer := method.newMessageWriter()
+
+	first := suite.request(writer, "repo.example.com")
+	suite.Equal("402 Authorization Required\nSite: repo.example.com\n\n", suite.next(recorder))
+	second := suite.request(writer, "repo.example.com")
+	suite.none(recorder)
+	other := suite.request(writer, "mirror.example.com")
+	suite.Equal("402 Authorization Required\nSite: mirror.example.com\n\n", suite.next(recorder))
+
+	reply := &Message{StatusCode: StatusCodeAuthorizationCredentials, Summary: "Authorization Credentials", Fields: Fields{}}
+	reply.Fields.Set("Site", "repo.example.com")
+	reply.Fields.Set("User", "apt")
+	reply.Fields.Set("Password", "secret")
+	suite.Require().NoError(method.dispatch(context.Background(), context.Background(), reply))
+	for _, result := range []<-chan credentialsResult{first, second} {
+		result := <-result
+		suite.NoError(result.err)
+		suite.Equal(AuthorizationCredentials{Site: "repo.example.com", User: "apt", Password: "secret"}, result.credentials)
+	}
+
+	// Asking again, e.g. after the credentials were rejected, sends a new request.
+	retry := suite.request(writer, "repo.example.com")
+	suite.Equal("402 Authorization Required\nSite: repo.example.com\n\n", suite.next(recorder))
+	suite.True(method.authorization.deliver(AuthorizationCredentials{Site: "repo.example.com"}))
+	suite.ErrorIs((<-retry).err, ErrCredentialsNotProvided)
+
+	suite.False(method.authorization.deliver(AuthorizationCredentials{Site: "unknown.example.com"}))
+	method.authorization.close()
+	suite.ErrorIs((<-other).err, ErrMethodShutdown)
+}
+
+func (suite *AuthorizationSuite) TestWithoutMethod() {
+	writer := NewMessageWriter(make(messageRecorder, 1))
+	_, err := writer.RequestCredentials(context.Background(), "repo.example.com")
+	suite.ErrorIs(err, ErrNoMethod)
+}
+
+func TestAuthorization(test *testing.T) {
+	suite.Run(test, new(AuthorizationSuite))
+}
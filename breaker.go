@@ -0,0 +1,203 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultBreakerThreshold is the number of consecutive failures for a host
+// after which [CircuitBreaker] opens, unless configured otherwise.
+const DefaultBreakerThreshold = 5
+
+// DefaultBreakerCooldown is how long [CircuitBreaker] stays open before it
+// lets a single request through to probe the host, unless configured
+// otherwise.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// CircuitBreakerPolicy configures the [CircuitBreaker] middleware. Zero values
+// are taken from the configuration sent by APT, looked up with
+// [Configuration.ForHost], and then from the defaults:
+//
+//   - Acquire::<scheme>::Circuit-Breaker::Threshold
+//   - Acquire::<scheme>::Circuit-Breaker::Cooldown
+type CircuitBreakerPolicy struct {
+	Threshold int
+	Cooldown  time.Duration
+	// IsFailure decides whether an error counts against the host. By default,
+	// it is [IsTransient], so that e.g. a missing file does not open the
+	// circuit.
+	IsFailure func(error) bool
+}
+
+// CircuitBreaker returns a middleware that stops sending requests to a host
+// that keeps failing.
+//
+// Once Threshold requests for a host have failed in a row, the circuit opens,
+// and every request for the host fails at once with a transient [URIFailure]
+// instead of waiting for the host to time out. After the cooldown, the
+// circuit is half-open: a single request is let through to probe the host.
+// If it succeeds the circuit closes again, and otherwise it stays open for
+// another cooldown.
+//
+// Every change of state is reported to APT as a 104 Warning, and recorded as
+// an event on the span of the request's context.
+func CircuitBreaker(policy CircuitBreakerPolicy) Middleware {
+	breakers := &circuitBreakers{policy: policy, hosts: map[string]*circuitBreaker{}}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(writer *MessageWriter, request *Request) error {
+			breaker, err := breakers.get(writer.configuration, request)
+			if err != nil {
+				return err
+			}
+			if err := breaker.allow(writer, request); err != nil {
+				return err
+			}
+			err = next.AcquireResource(writer, request)
+			breaker.record(writer, request, err != nil && breaker.isFailure(err))
+			return err
+		})
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type circuitBreakers struct {
+	policy CircuitBreakerPolicy
+	mutex  sync.Mutex
+	hosts  map[string]*circuitBreaker
+}
+
+type circuitBreaker struct {
+	host      string
+	threshold int
+	cooldown  time.Duration
+	isFailure func(error) bool
+	mutex     sync.Mutex
+	state     breakerState
+	failures  int
+	opened    time.Time
+	probing   bool
+}
+
+func (breakers *circuitBreakers) get(cfg Configuration, request *Request) (*circuitBreaker, error) {
+	var scheme, host, hostname string
+	if request.Source != nil {
+		scheme, host, hostname = request.Source.Scheme, request.Source.Host, request.Source.Hostname()
+	}
+	breakers.mutex.Lock()
+	defer breakers.mutex.Unlock()
+	if breaker, ok := breakers.hosts[host]; ok {
+		return breaker, nil
+	}
+	policy := breakers.policy
+	if policy.Threshold == 0 {
+		threshold, err := cfg.ForHost(scheme, hostname, "Circuit-Breaker::Threshold").Int(DefaultBreakerThreshold)
+		if err != nil {
+			return nil, err
+		}
+		policy.Threshold = int(threshold)
+	}
+	if policy.Cooldown == 0 {
+		cooldown, err := cfg.ForHost(scheme, hostname, "Circuit-Breaker::Cooldown").Duration(DefaultBreakerCooldown)
+		if err != nil {
+			return nil, err
+		}
+		policy.Cooldown = cooldown
+	}
+	if policy.IsFailure == nil {
+		policy.IsFailure = IsTransient
+	}
+	breaker := &circuitBreaker{
+		host:      host,
+		threshold: max(policy.Threshold, 1),
+		cooldown:  policy.Cooldown,
+		isFailure: policy.IsFailure,
+	}
+	breakers.hosts[host] = breaker
+	return breaker, nil
+}
+
+// allow decides whether the request may be made, moving an open circuit to
+// half-open once its cooldown has passed.
+func (breaker *circuitBreaker) allow(writer *MessageWriter, request *Request) error {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	switch breaker.state {
+	case breakerClosed:
+		return nil
+	case breakerOpen:
+		remaining := breaker.cooldown - time.Since(breaker.opened)
+		if remaining > 0 {
+			return breaker.rejection(request, remaining)
+		}
+		breaker.transition(writer, request, breakerHalfOpen, "Circuit breaker for %s is half-open, probing the host")
+	}
+	if breaker.probing {
+		return breaker.rejection(request, 0)
+	}
+	breaker.probing = true
+	return nil
+}
+
+// record counts the outcome of a request that was allowed through.
+func (breaker *circuitBreaker) record(writer *MessageWriter, request *Request, failed bool) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	wasProbe := breaker.state == breakerHalfOpen && breaker.probing
+	if wasProbe {
+		breaker.probing = false
+	}
+	if !failed {
+		breaker.failures = 0
+		if breaker.state != breakerClosed {
+			breaker.transition(writer, request, breakerClosed, "Circuit breaker for %s closed, the host has recovered")
+		}
+		return
+	}
+	breaker.failures++
+	if wasProbe || (breaker.state == breakerClosed && breaker.failures >= breaker.threshold) {
+		breaker.opened = time.Now()
+		breaker.transition(writer, request, breakerOpen, fmt.Sprintf("Circuit breaker for %%s opened after %d consecutive failures", breaker.failures))
+	}
+}
+
+// transition changes the state of the circuit, and reports it. The mutex must
+// be held by the caller.
+func (breaker *circuitBreaker) transition(writer *MessageWriter, request *Request, state breakerState, format string) {
+	breaker.state = state
+	writer.Warningf(format, breaker.host)
+	trace.SpanFromContext(request.Context()).AddEvent("circuit breaker "+state.String(),
+		trace.WithAttributes(
+			attribute.String("circuit_breaker.host", breaker.host),
+			attribute.String("circuit_breaker.state", state.String()),
+			attribute.Int("circuit_breaker.failures", breaker.failures),
+		))
+}
+
+func (breaker *circuitBreaker) rejection(request *Request, remaining time.Duration) error {
+	message := fmt.Sprintf("Circuit breaker for %s is open after %d consecutive failures", breaker.host, breaker.failures)
+	if remaining > 0 {
+		message += fmt.Sprintf(", retrying the host in %s", formatRetryDelay(remaining))
+	}
+	return &URIFailure{URI: requestURI(request), Message: message, Transient: true}
+}
+
+func (state breakerState) String() string {
+	switch state {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CircuitBreakerSuite struct {
+	suite.Suite
+}
+
+func (suite *CircuitBreakerSuite) TestCircuitBreaker() {
+	output := strings.Builder{}
+	writer := NewMessageWriter(&output)
+	var failure error = syscall.ECONNREFUSED
+	calls := 0
+	handler := CircuitBreaker(CircuitBreakerPolicy{Threshold: 2, Cooldown: 20 * time.Millisecond})(HandlerFunc(func(*MessageWriter, *Request) error {
+		calls++
+		return failure
+	}))
+
+	suite.ErrorIs(handler.AcquireResource(writer, newTestRequest()), syscall.ECONNREFUSED)
+	suite.NotContains(output.String(), "104 Warning")
+	suite.ErrorIs(handler.AcquireResource(writer, newTestRequest()), syscall.ECONNREFUSED)
+	suite.Contains(output.String(), "104 Warning\nMessage: Circuit breaker for bucket opened after 2 consecutive failures\n\n")
+
+	err := handler.AcquireResource(writer, newTestRequest())
+	rejected := &URIFailure{}
+	suite.Require().ErrorAs(err, &rejected)
+	suite.True(rejected.Transient)
+	suite.Contains(rejected.Message, "Circuit breaker for bucket is open after 2 consecutive failures, retrying the host in")
+	suite.Equal(2, calls)
+
+	// A failed probe opens the circuit again.
+	time.Sleep(25 * time.Millisecond)
+	suite.ErrorIs(handler.AcquireResource(writer, newTestRequest()), syscall.ECONNREFUSED)
+	suite.Contains(output.String(), "Circuit breaker for bucket is half-open, probing the host")
+	suite.ErrorAs(handler.AcquireResource(writer, newTestRequest()), &rejected)
+	suite.Equal(3, calls)
+
+	time.Sleep(25 * time.Millisecond)
+	failure = nil
+	suite.NoError(handler.AcquireResource(writer, newTestRequest()))
+	suite.Contains(output.String(), "104 Warning\nMessage: Circuit breaker for bucket closed, the host has recovered\n\n")
+	suite.NoError(handler.AcquireResource(writer, newTestRequest()))
+	suite.Equal(5, calls)
+}
+
+func (suite *CircuitBreakerSuite) TestPermanentErrors() {
+	writer := NewMessageWriter(&strings.Builder{})
+	writer.configuration = Configuration{"Acquire::s3::Circuit-Breaker::Threshold": {"1"}}
+	missing := errors.New("no such object")
+	handler := CircuitBreaker(CircuitBreakerPolicy{})(HandlerFunc(func(*MessageWriter, *Request) error {
+		return missing
+	}))
+	for range 3 {
+		suite.ErrorIs(handler.AcquireResource(writer, newTestRequest()), missing)
+	}
+}
+
+func TestCircuitBreaker(test *testing.T) {
+	suite.Run(test, new(CircuitBreakerSuite))
+}
@@ -0,0 +1,335 @@
+package transport
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Decode fills the struct pointed to by destination with values taken from
+// the configuration.
+//
+// The key used for each struct field is given by the "apt" key in the struct
+// field's tag, and defaults to the name of the field. A tag of "-" skips the
+// field entirely. A default value may be given after the key, and is used when
+// the key is not present in the configuration:
+//
+//	type Settings struct {
+//		Timeout time.Duration `apt:"Acquire::s3::Timeout,default=30"`
+//		Verify  bool          `apt:"Acquire::s3::Verify-Peer,default=yes"`
+//	}
+//
+// As the default is taken verbatim, it must be the last option in the tag.
+//
+// Struct fields that are themselves structs are treated as nested sections.
+// Their key is used as a prefix for the keys of their own fields, allowing
+// a method to describe its section once:
+//
+//	type Settings struct {
+//		S3 struct {
+//			Timeout time.Duration `apt:"Timeout,default=30"`
+//			Region  string        `apt:"Region"`
+//		} `apt:"Acquire::s3"`
+//	}
+//
+// Values are converted following APT's own rules. Booleans accept the same
+// spellings as apt.conf (yes/no, true/false, on/off, with/without,
+// enable/disable and 1/0), and durations without a unit are taken to be in
+// seconds, as is done for options like Acquire::http::Timeout. Slices are
+// filled from the list entries of a key (see [Configuration.List]), falling
+// back to a comma separated value when the key has no list entries. Any type
+// implementing [encoding.TextUnmarshaler] is also supported.
+//
+// Errors that occur while converting a value are returned as a
+// [ConfigurationError] that names the offending key.
+func (cfg Configuration) Decode(destination any) error {
+	value := reflect.ValueOf(destination)
+	if value.Kind() != reflect.Ptr {
+		return ErrDestinationNotPointer
+	}
+	if value.IsNil() {
+		return ErrDestinationIsNil
+	}
+	value = value.Elem()
+	if value.Kind() != reflect.Struct {
+		return ErrDestinationNotStruct
+	}
+	return cfg.decodeStruct("", value)
+}
+
+func (cfg Configuration) decodeStruct(prefix string, value reflect.Value) error {
+	for index := range value.NumField() {
+		member := value.Type().Field(index)
+		if !member.IsExported() {
+			continue
+		}
+		tag, tagged := member.Tag.Lookup("apt")
+		if tag == "-" {
+			continue
+		}
+		key, option, _ := strings.Cut(tag, ",")
+		fallback, hasFallback := strings.CutPrefix(option, "default=")
+		entry := value.Field(index)
+		// Untagged embedded structs share the section of their parent.
+		if member.Anonymous && !tagged && entry.Kind() == reflect.Struct {
+			if err := cfg.decodeStruct(prefix, entry); err != nil {
+				return err
+			}
+			continue
+		}
+		if key == "" {
+			key = member.Name
+		}
+		key = joinConfigurationKey(prefix, key)
+		if isConfigurationSection(entry) {
+			if err := cfg.decodeStruct(key, entry); err != nil {
+				return err
+			}
+			continue
+		}
+		if items := cfg.List(key); len(items) != 0 && isConfigurationList(entry) {
+			if err := decodeConfigurationList(items, entry); err != nil {
+				return &ConfigurationError{Key: key, Err: err}
+			}
+			continue
+		}
+		text, ok := cfg.Get(key), len(cfg[key]) != 0
+		if !ok && !hasFallback {
+			continue
+		} else if !ok {
+			text = fallback
+		}
+		if err := decodeConfigurationValue(text, entry); err != nil {
+			return &ConfigurationError{Key: key, Err: err}
+		}
+	}
+	return nil
+}
+
+// ConfigurationValue is a setting found by [Configuration.ForHost]. Key is the
+// configuration key the value was taken from, which is useful when logging
+// why a particular setting was used. When no key was found, Found is false,
+// Key is empty, and the typed accessors return their fallback.
+type ConfigurationValue struct {
+	Key   string
+	Value string
+	Found bool
+}
+
+// ForHost looks up a setting that APT allows to be overridden per host,
+// following the same precedence APT's own methods do:
+//
+//  1. Acquire::<scheme>::<key>::<host> (e.g., Acquire::http::Proxy::example.com)
+//  2. Acquire::<scheme>::<host>::<key> (e.g., Acquire::https::example.com::Verify-Peer)
+//  3. Acquire::<scheme>::<key>
+//  4. Acquire::<key>
+//
+// The first key present in the configuration is used. If host is empty, the
+// host specific keys are skipped. Defaults are given to the typed accessors of
+// the returned [ConfigurationValue].
+func (cfg Configuration) ForHost(scheme, host, key string) ConfigurationValue {
+	keys := []string{}
+	if host != "" {
+		keys = append(keys,
+			fmt.Sprintf("Acquire::%s::%s::%s", scheme, key, host),
+			fmt.Sprintf("Acquire::%s::%s::%s", scheme, host, key))
+	}
+	keys = append(keys,
+		fmt.Sprintf("Acquire::%s::%s", scheme, key),
+		fmt.Sprintf("Acquire::%s", key))
+	for _, candidate := range keys {
+		if len(cfg[candidate]) != 0 {
+			return ConfigurationValue{Key: candidate, Value: cfg.Get(candidate), Found: true}
+		}
+	}
+	return ConfigurationValue{}
+}
+
+// String returns the value, or the fallback if no value was found.
+func (value ConfigurationValue) String(fallback string) string {
+	if !value.Found {
+		return fallback
+	}
+	return value.Value
+}
+
+// Bool returns the value as a boolean, using APT's spellings (see
+// [Configuration.Decode]), or the fallback if no value was found.
+func (value ConfigurationValue) Bool(fallback bool) (bool, error) {
+	if !value.Found {
+		return fallback, nil
+	}
+	parsed, err := parseAPTBool(value.Value)
+	if err != nil {
+		return fallback, &ConfigurationError{Key: value.Key, Err: err}
+	}
+	return parsed, nil
+}
+
+// Int returns the value as an integer, or the fallback if no value was found.
+func (value ConfigurationValue) Int(fallback int64) (int64, error) {
+	if !value.Found {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseInt(strings.TrimSpace(value.Value), 0, 64)
+	if err != nil {
+		return fallback, &ConfigurationError{Key: value.Key, Err: err}
+	}
+	return parsed, nil
+}
+
+// Float returns the value as a floating point number, or the fallback if no
+// value was found.
+func (value ConfigurationValue) Float(fallback float64) (float64, error) {
+	if !value.Found {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value.Value), 64)
+	if err != nil {
+		return fallback, &ConfigurationError{Key: value.Key, Err: err}
+	}
+	return parsed, nil
+}
+
+// Duration returns the value as a duration, or the fallback if no value was
+// found. Values without a unit are taken to be in seconds.
+func (value ConfigurationValue) Duration(fallback time.Duration) (time.Duration, error) {
+	if !value.Found {
+		return fallback, nil
+	}
+	parsed, err := parseAPTDuration(value.Value)
+	if err != nil {
+		return fallback, &ConfigurationError{Key: value.Key, Err: err}
+	}
+	return parsed, nil
+}
+
+// isConfigurationSection reports whether the value should be decoded as a
+// nested section, rather than from a single configuration value.
+func isConfigurationSection(value reflect.Value) bool {
+	if value.Kind() != reflect.Struct {
+		return false
+	}
+	return !reflect.PointerTo(value.Type()).Implements(textUnmarshalerType)
+}
+
+// isConfigurationList reports whether the value should be decoded from the
+// list entries of a key.
+func isConfigurationList(value reflect.Value) bool {
+	if value.Kind() != reflect.Slice {
+		return false
+	}
+	return !reflect.PointerTo(value.Type()).Implements(textUnmarshalerType)
+}
+
+func decodeConfigurationList(items []string, value reflect.Value) error {
+	slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+	for index, item := range items {
+		if err := decodeConfigurationValue(item, slice.Index(index)); err != nil {
+			return fmt.Errorf("list item %d: %w", index, err)
+		}
+	}
+	value.Set(slice)
+	return nil
+}
+
+func decodeConfigurationValue(text string, value reflect.Value) error {
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+	if value.Type() == durationType {
+		duration, err := parseAPTDuration(text)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		parsed, err := parseAPTBool(text)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(strings.TrimSpace(text), 0, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(strings.TrimSpace(text), 0, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(text), value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		return decodeConfigurationList(splitConfigurationList(text), value)
+	case reflect.Ptr:
+		pointer := reflect.New(value.Type().Elem())
+		if err := decodeConfigurationValue(text, pointer.Elem()); err != nil {
+			return err
+		}
+		value.Set(pointer)
+	default:
+		return fmt.Errorf("cannot decode into type %q, no known conversion", value.Type())
+	}
+	return nil
+}
+
+// parseAPTBool converts text to a boolean the same way APT's StringToBool
+// does.
+func parseAPTBool(text string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "1", "yes", "true", "with", "on", "enable":
+		return true, nil
+	case "0", "no", "false", "without", "off", "disable":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", text)
+}
+
+// parseAPTDuration converts text to a duration. APT expresses most durations
+// as a plain number of seconds, but Go style durations (e.g., "120s") are
+// also accepted.
+func parseAPTDuration(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(text)
+}
+
+func splitConfigurationList(text string) []string {
+	items := []string{}
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func joinConfigurationKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return strings.TrimSuffix(prefix, "::") + "::" + key
+}
@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DecodeSuite struct {
+	suite.Suite
+}
+
+func (suite *DecodeSuite) TestDecode() {
+	cfg := Configuration{
+		"Acquire::s3::Timeout":     {"120s"},
+		"Acquire::s3::Verify-Peer": {"off"},
+		"Acquire::s3::Retries":     {"5"},
+		"Acquire::s3::Region":      {"us-east-1"},
+		"Acquire::s3::Hosts":       {"a, b"},
+		"Acquire::Languages::":     {"en", "de"},
+		"Debug::Acquire::s3":       {"yes"},
+	}
+	settings := struct {
+		S3 struct {
+			Timeout    time.Duration `apt:"Timeout,default=30"`
+			VerifyPeer bool          `apt:"Verify-Peer,default=true"`
+			Retries    int           `apt:"Retries"`
+			Region     string        `apt:"Region"`
+			Proxy      string        `apt:"Proxy,default=DIRECT"`
+			Hosts      []string      `apt:"Hosts"`
+		} `apt:"Acquire::s3"`
+		Languages []string `apt:"Acquire::Languages"`
+		Debug     bool     `apt:"Debug::Acquire::s3"`
+		Ignored   string   `apt:"-"`
+	}{}
+	suite.Require().NoError(cfg.Decode(&settings))
+	suite.Equal(120*time.Second, settings.S3.Timeout)
+	suite.False(settings.S3.VerifyPeer)
+	suite.Equal(5, settings.S3.Retries)
+	suite.Equal("us-east-1", settings.S3.Region)
+	suite.Equal("DIRECT", settings.S3.Proxy)
+	suite.Equal([]string{"a", "b"}, settings.S3.Hosts)
+	suite.Equal([]string{"en", "de"}, settings.Languages)
+	suite.True(settings.Debug)
+}
+
+func (suite *DecodeSuite) TestDecodeDefaults() {
+	settings := struct {
+		Timeout time.Duration `apt:"Acquire::s3::Timeout,default=30"`
+		Enabled bool          `apt:"Acquire::s3::Enabled,default=with"`
+		Hosts   []string      `apt:"Acquire::s3::Hosts,default=a,b"`
+	}{}
+	suite.Require().NoError(Configuration{}.Decode(&settings))
+	suite.Equal(30*time.Second, settings.Timeout)
+	suite.True(settings.Enabled)
+	suite.Equal([]string{"a", "b"}, settings.Hosts)
+}
+
+func (suite *DecodeSuite) TestDecodeError() {
+	cfg := Configuration{"Acquire::s3::Retries": {"many"}}
+	settings := struct {
+		Retries int `apt:"Acquire::s3::Retries"`
+	}{}
+	err := cfg.Decode(&settings)
+	var target *ConfigurationError
+	suite.Require().ErrorAs(err, &target)
+	suite.Equal("Acquire::s3::Retries", target.Key)
+	suite.Contains(err.Error(), "Acquire::s3::Retries")
+}
+
+func (suite *DecodeSuite) TestDecodeInvalidBoolean() {
+	cfg := Configuration{"Acquire::s3::Verify-Peer": {"maybe"}}
+	settings := struct {
+		VerifyPeer bool `apt:"Acquire::s3::Verify-Peer"`
+	}{}
+	suite.ErrorContains(cfg.Decode(&settings), "Acquire::s3::Verify-Peer")
+}
+
+func (suite *DecodeSuite) TestDecodeDestination() {
+	suite.ErrorIs(Configuration{}.Decode(struct{}{}), ErrDestinationNotPointer)
+	suite.ErrorIs(Configuration{}.Decode((*struct{})(nil)), ErrDestinationIsNil)
+	value := 0
+	suite.ErrorIs(Configuration{}.Decode(&value), ErrDestinationNotStruct)
+}
+
+type ForHostSuite struct {
+	suite.Suite
+}
+
+func (suite *ForHostSuite) TestPrecedence() {
+	cfg := Configuration{
+		"Acquire::http::Proxy::mirror.example.com":        {"DIRECT"},
+		"Acquire::http::Proxy":                            {"http://proxy.example.com:3128"},
+		"Acquire::https::secure.example.com::Verify-Peer": {"false"},
+		"Acquire::Retries":                                {"5"},
+	}
+	value := cfg.ForHost("http", "mirror.example.com", "Proxy")
+	suite.Equal("Acquire::http::Proxy::mirror.example.com", value.Key)
+	suite.Equal("DIRECT", value.String(""))
+
+	value = cfg.ForHost("http", "other.example.com", "Proxy")
+	suite.Equal("Acquire::http::Proxy", value.Key)
+	suite.Equal("http://proxy.example.com:3128", value.String(""))
+
+	verify, err := cfg.ForHost("https", "secure.example.com", "Verify-Peer").Bool(true)
+	suite.Require().NoError(err)
+	suite.False(verify)
+
+	value = cfg.ForHost("http", "mirror.example.com", "Retries")
+	suite.Equal("Acquire::Retries", value.Key)
+	retries, err := value.Int(3)
+	suite.Require().NoError(err)
+	suite.Equal(int64(5), retries)
+}
+
+func (suite *ForHostSuite) TestDefaults() {
+	value := Configuration{}.ForHost("s3", "bucket", "Timeout")
+	suite.False(value.Found)
+	suite.Empty(value.Key)
+	timeout, err := value.Duration(30 * time.Second)
+	suite.Require().NoError(err)
+	suite.Equal(30*time.Second, timeout)
+	suite.Equal("fallback", value.String("fallback"))
+}
+
+func (suite *ForHostSuite) TestInvalidValue() {
+	cfg := Configuration{"Acquire::s3::bucket::Timeout": {"soon"}}
+	_, err := cfg.ForHost("s3", "bucket", "Timeout").Duration(time.Second)
+	var target *ConfigurationError
+	suite.Require().ErrorAs(err, &target)
+	suite.Equal("Acquire::s3::bucket::Timeout", target.Key)
+}
+
+func TestConfiguration(test *testing.T) {
+	suite.Run(test, new(DecodeSuite))
+	suite.Run(test, new(ForHostSuite))
+}
@@ -0,0 +1,118 @@
+package transport
+
+import "strings"
+
+// directoryDefaults are the values APT assigns to the Dir:: tree when it
+// initializes its configuration (see apt-pkg/init.cc). They are used when a
+// key is missing, so that FindFile and FindDir give the same answer for a
+// Configuration loaded with [LoadAPTConfDir] as for one sent by APT.
+var directoryDefaults = map[string]string{
+	"Dir":                        "/",
+	"Dir::State":                 "var/lib/apt/",
+	"Dir::State::lists":          "lists/",
+	"Dir::State::cdroms":         "cdroms.list",
+	"Dir::Cache":                 "var/cache/apt/",
+	"Dir::Cache::archives":       "archives/",
+	"Dir::Cache::pkgcache":       "pkgcache.bin",
+	"Dir::Cache::srcpkgcache":    "srcpkgcache.bin",
+	"Dir::Etc":                   "etc/apt/",
+	"Dir::Etc::main":             "apt.conf",
+	"Dir::Etc::netrc":            "auth.conf",
+	"Dir::Etc::netrcparts":       "auth.conf.d",
+	"Dir::Etc::parts":            "apt.conf.d",
+	"Dir::Etc::preferences":      "preferences",
+	"Dir::Etc::preferencesparts": "preferences.d",
+	"Dir::Etc::sourcelist":       "sources.list",
+	"Dir::Etc::sourceparts":      "sources.list.d",
+	"Dir::Etc::trusted":          "trusted.gpg",
+	"Dir::Etc::trustedparts":     "trusted.gpg.d",
+	"Dir::Log":                   "var/log/apt",
+	"Dir::Log::Terminal":         "term.log",
+	"Dir::Log::History":          "history.log",
+	"Dir::Media::MountPath":      "/media/apt",
+	"Dir::Bin::methods":          "/usr/lib/apt/methods",
+}
+
+// FindFile resolves the file path stored at key the same way APT's
+// Configuration::FindFile does.
+//
+// Relative values are joined with the value of each parent key in turn, so
+// that with the default configuration "Dir::Etc::netrc" resolves to
+// "/etc/apt/auth.conf", and with "-o Dir=/tmp/root" it resolves to
+// "/tmp/root/etc/apt/auth.conf". Joining stops at the first absolute value,
+// or at a value starting with "./", "../" or "~/". Values starting with
+// "/dev/null" are truncated to exactly "/dev/null", which APT uses to disable
+// a file. When set, "RootDir" is prepended to the result.
+//
+// Keys under Dir:: that are missing from the configuration fall back to the
+// defaults APT itself uses. If there is still no value, only the root
+// directory (if any) is returned.
+func (cfg Configuration) FindFile(key string) string {
+	root := cfg.Get("RootDir")
+	if root != "" && !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	value := cfg.findDirectoryValue(key)
+	if value == "" {
+		return root
+	}
+	tags := strings.Split(key, "::")
+	for index := len(tags) - 1; index > 0; index-- {
+		parent := cfg.findDirectoryValue(strings.Join(tags[:index], "::"))
+		if parent == "" {
+			continue
+		}
+		if strings.HasPrefix(value, "/") {
+			if strings.HasPrefix(value, "/dev/null") {
+				value = "/dev/null"
+			}
+			break
+		}
+		if hasExplicitRelativePrefix(value) {
+			break
+		}
+		if !strings.HasSuffix(parent, "/") {
+			value = "/" + value
+		}
+		value = parent + value
+	}
+	for strings.Contains(value, "/./") {
+		value = strings.ReplaceAll(value, "/./", "/")
+	}
+	for strings.Contains(value, "//") {
+		value = strings.ReplaceAll(value, "//", "/")
+	}
+	value = strings.TrimPrefix(value, "./")
+	if root != "" {
+		value = strings.TrimPrefix(value, "/")
+	}
+	return root + value
+}
+
+// FindDir resolves the directory path stored at key the same way APT's
+// Configuration::FindDir does. It behaves exactly like
+// [Configuration.FindFile], but ensures the result ends with a "/" unless the
+// directory was disabled by setting it to "/dev/null".
+func (cfg Configuration) FindDir(key string) string {
+	path := cfg.FindFile(key)
+	if strings.HasSuffix(path, "/") || strings.HasSuffix(path, "/dev/null") {
+		return path
+	}
+	return path + "/"
+}
+
+func (cfg Configuration) findDirectoryValue(key string) string {
+	if value := cfg.Get(key); value != "" {
+		return value
+	}
+	return directoryDefaults[key]
+}
+
+func hasExplicitRelativePrefix(value string) bool {
+	for _, prefix := range []string{"./", "../", "~/"} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
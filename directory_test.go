@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DirectorySuite struct {
+	suite.Suite
+}
+
+func (suite *DirectorySuite) TestDefaults() {
+	cfg := Configuration{}
+	suite.Equal("/var/lib/apt/lists/", cfg.FindDir("Dir::State::lists"))
+	suite.Equal("/var/cache/apt/archives/", cfg.FindDir("Dir::Cache::archives"))
+	suite.Equal("/etc/apt/auth.conf", cfg.FindFile("Dir::Etc::netrc"))
+	suite.Equal("/etc/apt/trusted.gpg.d/", cfg.FindDir("Dir::Etc::trustedparts"))
+}
+
+func (suite *DirectorySuite) TestRoot() {
+	cfg := Configuration{"Dir": {"/tmp/root"}}
+	suite.Equal("/tmp/root/var/lib/apt/lists/", cfg.FindDir("Dir::State::lists"))
+	suite.Equal("/tmp/root/etc/apt/auth.conf", cfg.FindFile("Dir::Etc::netrc"))
+
+	cfg = Configuration{"RootDir": {"/chroot"}}
+	suite.Equal("/chroot/etc/apt/auth.conf", cfg.FindFile("Dir::Etc::netrc"))
+}
+
+func (suite *DirectorySuite) TestOverrides() {
+	cfg := Configuration{
+		"Dir":                  {"/tmp/root/"},
+		"Dir::Etc::netrc":      {"/srv/apt/auth.conf"},
+		"Dir::State":           {"./state"},
+		"Dir::State::lists":    {"/dev/null/ignored"},
+		"Dir::Cache":           {"cache//apt/./"},
+		"Dir::Cache::archives": {"debs"},
+	}
+	suite.Equal("/srv/apt/auth.conf", cfg.FindFile("Dir::Etc::netrc"))
+	suite.Equal("state/", cfg.FindDir("Dir::State"))
+	suite.Equal("/dev/null", cfg.FindDir("Dir::State::lists"))
+	suite.Equal("/tmp/root/cache/apt/debs/", cfg.FindDir("Dir::Cache::archives"))
+}
+
+func (suite *DirectorySuite) TestMissing() {
+	suite.Equal("", Configuration{}.FindFile("Acquire::s3::CredentialsFile"))
+	suite.Equal("/chroot/", Configuration{"RootDir": {"/chroot"}}.FindFile("Missing"))
+}
+
+func TestDirectory(test *testing.T) {
+	suite.Run(test, new(DirectorySuite))
+}
@@ -24,12 +24,42 @@ var (
 	ErrFieldsEmpty       = errors.New("header fields are empty")
 
 	ErrInvalidConfigurationItem = errors.New("configuration item is invalid")
+	ErrConfigurationTimeout     = errors.New("timed out waiting for configuration")
+	ErrConfigurationNotReceived = errors.New("configuration was not received")
+	ErrAPTConfSyntax            = errors.New("apt.conf syntax error")
+
+	ErrUnexpectedMessage = errors.New("unexpected message received")
 
 	ErrEmptyInformationalMessage = errors.New("informational message is empty")
 
+	ErrMethodShutdown    = errors.New("method was shut down")
+	ErrRequestsAbandoned = errors.New("requests were abandoned during shutdown")
+
+	ErrNoMethod        = errors.New("message writer does not belong to a method")
+	ErrMediaNotChanged = errors.New("media was not changed")
+
+	ErrCredentialsNotProvided = errors.New("credentials were not provided")
+
+	ErrAuxRequestsNotAdvertised = errors.New("aux requests capability was not advertised")
+	ErrAuxFileMissing           = errors.New("auxiliary file was not acquired")
+
+	ErrHandlerPanic = errors.New("handler panicked")
+	ErrNoHandler    = errors.New("no handler for uri")
+
+	ErrStdoutGuardUnsupported = errors.New("stdout guard is not supported on this platform")
+
+	ErrNoTarget = errors.New("request has no target file")
+
 	ErrNotImplemented = errors.New("not implemented")
 )
 
+// ConfigurationError is returned when a value in a [Configuration] cannot be
+// decoded. It names the configuration key that failed.
+type ConfigurationError struct {
+	Key string
+	Err error
+}
+
 // MessageMarshalerError is used when performing automatic reflection-based
 // marhsalling into a message.
 type MessageMarshalerError struct {
@@ -77,3 +107,11 @@ func (err *MessageMarshalerError) Error() string {
 func (err *MessageMarshalerError) Unwrap() error {
 	return err.Err
 }
+
+func (err *ConfigurationError) Error() string {
+	return fmt.Sprintf("apt/transport: invalid value for configuration key %q: %s", err.Key, err.Err.Error())
+}
+
+func (err *ConfigurationError) Unwrap() error {
+	return err.Err
+}
@@ -6,9 +6,11 @@ import (
 	"encoding"
 	"fmt"
 	"io"
+	"maps"
 	"net/textproto"
 	"net/url"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -120,10 +122,12 @@ func (fields Fields) MarshalBinary() ([]byte, error) {
 	if len(fields) == 0 {
 		return nil, ErrFieldsEmpty
 	}
-	for key, values := range fields {
-		key := CanonicalFieldsKey(key)
-		value := strings.Join(values, ",")
-		fmt.Fprintf(&buffer, "%s: %s\n", key, value)
+	// Keys are sorted so that the output is stable, and repeated values are
+	// written on their own line, as is done for fields like Config-Item.
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		for _, value := range fields[key] {
+			fmt.Fprintf(&buffer, "%s: %s\n", CanonicalFieldsKey(key), value)
+		}
 	}
 	return buffer.Bytes(), nil
 }
@@ -134,6 +138,10 @@ func (fields Fields) MarshalBinary() ([]byte, error) {
 // fields. It also does not validate that a fields field is not empty, as this
 // is technically allowed.
 //
+// Each line is treated as a single value. Values are NOT split on commas, as
+// APT repeats a field (e.g., Config-Item) when it has several values, and
+// values such as Last-Modified legitimately contain commas.
+//
 // BUG(bruxisma): This function does not currently handle multi-line fields.
 func (fields Fields) UnmarshalBinary(data []byte) error {
 	scanner := bufio.NewScanner(bytes.NewReader(data))
@@ -147,11 +155,7 @@ func (fields Fields) UnmarshalBinary(data []byte) error {
 			return fmt.Errorf("%w %q", ErrFieldEntryInvalid, line)
 		}
 		key := CanonicalFieldsKey(items[0])
-		values := strings.Split(items[1], ",")
-		for _, value := range values {
-			value = strings.TrimSpace(value)
-			fields.Add(key, value)
-		}
+		fields.Add(key, strings.TrimSpace(items[1]))
 	}
 	return scanner.Err()
 }
@@ -231,17 +235,31 @@ func MarshalFields(source any) (Fields, error) {
 
 	members := reflect.VisibleFields(value.Type())
 	for _, member := range members {
+		if !member.IsExported() {
+			continue
+		}
 		field := GetFieldName(member)
+		entry := value.FieldByName(member.Name)
+		// nil pointers (e.g., an unset *url.URL) have nothing to send.
+		if entry.Kind() == reflect.Ptr && entry.IsNil() {
+			continue
+		}
 		// TODO: get the entry, as an Interface value, then run through TextMarshaler, Stringer, etc.
-		ifc := value.FieldByName(member.Name).Interface()
+		ifc := entry.Interface()
 		var content string
 		switch ifc.(type) {
+		case bool:
+			content = strconv.FormatBool(ifc.(bool))
+		case int, int8, int16, int32, int64:
+			content = strconv.FormatInt(entry.Int(), 10)
+		case uint, uint8, uint16, uint32, uint64:
+			content = strconv.FormatUint(entry.Uint(), 10)
 		case string:
 			content = ifc.(string)
 		case *time.Time:
-			content = ifc.(*time.Time).Format(time.RFC1123)
+			content = formatTime(*ifc.(*time.Time))
 		case time.Time:
-			content = ifc.(time.Time).Format(time.RFC1123)
+			content = formatTime(ifc.(time.Time))
 		case fmt.Stringer:
 			content = ifc.(fmt.Stringer).String()
 		case encoding.TextMarshaler:
@@ -257,6 +275,10 @@ func MarshalFields(source any) (Fields, error) {
 				source: "MarshalFields",
 			}
 		}
+		// Empty fields carry no information, and are not sent.
+		if content == "" {
+			continue
+		}
 		fields.Add(field, content)
 	}
 	return fields, nil
@@ -298,8 +320,15 @@ func UnmarshalFields(fields Fields, destination any) error {
 	// Get a list of all visible fields in the destination
 	members := reflect.VisibleFields(value.Type())
 	for _, member := range members {
+		if !member.IsExported() {
+			continue
+		}
 		field := GetFieldName(member)
-		// skip fields that are not in the fields map
+		// skip fields that are not in the fields map. Fields parsed off the wire
+		// are canonicalized, so both forms are checked.
+		if _, ok := fields[field]; !ok {
+			field = CanonicalFieldsKey(field)
+		}
 		if _, ok := fields[field]; !ok {
 			continue
 		}
@@ -375,8 +404,29 @@ func parseBool(text string) (bool, error) {
 	return strconv.ParseBool(text)
 }
 
+// timeFormat is the RFC 1123 format APT uses for times, which are always in
+// GMT.
+const timeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// parseTime parses a time sent by APT. APT always sends GMT, but other zone
+// abbreviations and numeric zones are accepted too. The time is returned in
+// UTC, rather than in a zone fabricated from the abbreviation.
 func parseTime(text string) (time.Time, error) {
-	return time.Parse(time.RFC1123, text)
+	parsed, err := time.Parse(timeFormat, text)
+	for _, layout := range []string{time.RFC1123, time.RFC1123Z} {
+		if err == nil {
+			break
+		}
+		if zoned, zonedErr := time.Parse(layout, text); zonedErr == nil {
+			parsed, err = zoned, nil
+		}
+	}
+	return parsed.UTC(), err
+}
+
+// formatTime formats a time the way APT does.
+func formatTime(value time.Time) string {
+	return value.UTC().Format(timeFormat)
 }
 
 func parseURI(text string) (*url.URL, error) {
@@ -1,7 +1,11 @@
 package transport
 
 import (
+	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -28,9 +32,9 @@ type Capabilities struct {
 //
 // APT will send the configuration 'space' to the transport method. A series of
 // Config-Items fields are sent, each containing an entry from the APT
-// configuration. Each item is placed verbatim into the map directly. No
-// canonicalization occurs, as these values come in directly from the APT
-// configuration space, and not as field headers.
+// configuration. Each item is placed into the map after APT's percent-quoting
+// has been decoded. No canonicalization occurs, as these values come in
+// directly from the APT configuration space, and not as field headers.
 //
 // While files found in `/etc/apt.conf.d/*.conf` will sometimes have several
 // settings:
@@ -40,6 +44,7 @@ type Capabilities struct {
 //    Get {
 //      Assume-Yes "true";
 //    };
+//    Architectures { "amd64"; "arm64"; };
 //  }
 //
 // Apt will then convert these into their full namespaced form before the
@@ -47,11 +52,47 @@ type Capabilities struct {
 //
 //   APT::Install-Recommends "false";
 //   APT::Get::Assume-Yes "true";
+//   APT::Architectures:: "amd64";
+//   APT::Architectures:: "arm64";
 //
 // This is the format that the transport method will receive, and is what users
 // should expect to look for. No parsing is done for the user as the content of
 // a setting can be, quite literally, anything.
-type Configuration map[string]string
+//
+// Much like [Fields], each key maps to a slice of values. Ordinary keys hold
+// a single value, which is replaced when the key is set again. List entries
+// (keys with a trailing "::") keep every value in the order they were
+// received, and are best accessed with [Configuration.List].
+type Configuration map[string][]string
+
+// ConfigurationNode is a single entry within the hierarchy returned by
+// [Configuration.Tree]. List entries are represented as children without a
+// Tag.
+type ConfigurationNode struct {
+	Tag      string
+	Value    string
+	Children []*ConfigurationNode
+}
+
+// Get returns the value associated with the given key. If there are no values
+// associated with the key, Get returns "". Unlike [Fields.Get], the key is
+// case sensitive.
+func (cfg Configuration) Get(key string) string {
+	values := cfg[key]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// List returns the list entries of the given key, in the order they were
+// received. For example, List("Acquire::Languages") returns every value
+// received for "Acquire::Languages::".
+//
+// The slice returned is NOT a copy.
+func (cfg Configuration) List(key string) []string {
+	return cfg[strings.TrimSuffix(key, "::")+"::"]
+}
 
 // Section returns a subsection of the configuration, based on the given
 // prefix. All keys in the returned subsection will have the prefix trimmed.
@@ -60,7 +101,7 @@ type Configuration map[string]string
 // and putting it into a smaller lookup:
 //
 //   confg := cfg.Section("APT::Get")
-//   fmt.Println(confg["Assume-Yes"])
+//   fmt.Println(confg.Get("Assume-Yes"))
 //
 // This reduces the amount of work and lookup required when a method has its
 // own configuration section
@@ -77,6 +118,98 @@ func (cfg Configuration) Section(prefix string) Configuration {
 	return section
 }
 
+// Tree returns the configuration as a hierarchy, mirroring the way it is
+// written in apt.conf. The returned root node has no Tag or Value. Named
+// children are sorted by their Tag, while list entries keep their order.
+func (cfg Configuration) Tree() *ConfigurationNode {
+	root := &ConfigurationNode{}
+	for _, key := range slices.Sorted(maps.Keys(cfg)) {
+		node := root
+		tags := strings.Split(key, "::")
+		for _, tag := range tags[:len(tags)-1] {
+			node = node.child(tag)
+		}
+		last := tags[len(tags)-1]
+		if last == "" {
+			for _, value := range cfg[key] {
+				node.Children = append(node.Children, &ConfigurationNode{Value: value})
+			}
+			continue
+		}
+		node.child(last).Value = cfg.Get(key)
+	}
+	return root
+}
+
+// Find returns the node found at key, relative to the receiver, or nil if
+// there is no such node.
+func (node *ConfigurationNode) Find(key string) *ConfigurationNode {
+	for _, tag := range strings.Split(key, "::") {
+		index := slices.IndexFunc(node.Children, func(child *ConfigurationNode) bool {
+			return child.Tag != "" && child.Tag == tag
+		})
+		if index < 0 {
+			return nil
+		}
+		node = node.Children[index]
+	}
+	return node
+}
+
+func (node *ConfigurationNode) child(tag string) *ConfigurationNode {
+	if child := node.Find(tag); child != nil {
+		return child
+	}
+	child := &ConfigurationNode{Tag: tag}
+	node.Children = append(node.Children, child)
+	return child
+}
+
+// Clone returns a copy of the configuration. Changes made to the copy are not
+// reflected in the original.
+func (cfg Configuration) Clone() Configuration {
+	clone := make(Configuration, len(cfg))
+	for key, values := range cfg {
+		clone[key] = slices.Clone(values)
+	}
+	return clone
+}
+
+type configurationKey struct{}
+
+// ConfigurationFromContext returns the [Configuration] APT sent to the
+// [Method] handling the request the context was created for. If there is no
+// configuration stored within the context, an empty Configuration is returned.
+func ConfigurationFromContext(ctx context.Context) Configuration {
+	if cfg, ok := ctx.Value(configurationKey{}).(Configuration); ok {
+		return cfg.Clone()
+	}
+	return Configuration{}
+}
+
+func (capabilities *Capabilities) MarshalMessage() (*Message, error) {
+	fields, err := MarshalFields(capabilities)
+	if err != nil {
+		return nil, err
+	}
+	message := &Message{
+		StatusCode: StatusCodeCapabilities,
+		Summary:    "Capabilities",
+		Fields:     fields,
+	}
+	return message, nil
+}
+
+func (cfg Configuration) UnmarshalMessage(message *Message) error {
+	if message.StatusCode != StatusCodeConfiguration {
+		return fmt.Errorf("%w: expected %q, received %q", ErrUnexpectedMessage, StatusText(StatusCodeConfiguration), StatusText(message.StatusCode))
+	}
+	return cfg.UnmarshalFields(message.Fields)
+}
+
+// UnmarshalFields decodes every Config-Item field into the configuration.
+// Both the key and the value of an item are decoded from APT's
+// percent-quoting (e.g., "%20" for a space).
 func (cfg Configuration) UnmarshalFields(fields Fields) error {
 	values := fields.Values("Config-Item")
 	for _, value := range values {
@@ -84,8 +217,50 @@ func (cfg Configuration) UnmarshalFields(fields Fields) error {
 		if len(parts) != 2 {
 			return fmt.Errorf("%w: received %q", ErrInvalidConfigurationItem, value)
 		}
-		key := strings.TrimSpace(parts[0])
-		cfg[key] = strings.TrimSpace(parts[1])
+		key := dequoteString(strings.TrimSpace(parts[0]))
+		cfg.add(key, dequoteString(strings.TrimSpace(parts[1])))
 	}
 	return nil
 }
+
+// add stores a single configuration entry the way APT does. List entries
+// (keys ending in "::") are appended, while any other key is replaced.
+func (cfg Configuration) add(key, value string) {
+	if strings.HasSuffix(key, "::") {
+		cfg[key] = append(cfg[key], value)
+		return
+	}
+	cfg[key] = []string{value}
+}
+
+// clear removes the key, and every key nested beneath it, as apt.conf's #clear
+// directive does.
+func (cfg Configuration) clear(key string) {
+	key = strings.TrimSuffix(key, "::")
+	for existing := range cfg {
+		if existing == key || strings.HasPrefix(existing, key+"::") {
+			delete(cfg, existing)
+		}
+	}
+}
+
+// dequoteString reverses APT's QuoteString, replacing every "%XX" hex escape
+// with the byte it represents. Malformed escapes are kept verbatim, as APT's
+// DeQuoteString does.
+func dequoteString(text string) string {
+	if !strings.Contains(text, "%") {
+		return text
+	}
+	builder := strings.Builder{}
+	for index := 0; index < len(text); index++ {
+		if text[index] == '%' && index+2 < len(text) {
+			if value, err := strconv.ParseUint(text[index+1:index+3], 16, 8); err == nil {
+				builder.WriteByte(byte(value))
+				index += 2
+				continue
+			}
+		}
+		builder.WriteByte(text[index])
+	}
+	return builder.String()
+}
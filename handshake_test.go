@@ -1,8 +1,13 @@
 package transport
 
 import (
+	"context"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -24,6 +29,151 @@ func (suite *ConfigurationSuite) TestConfigurationUnmarshalFields() {
 	suite.Contains(configuration.Section("APT"), "Get::Assume-Yes")
 }
 
+func (suite *ConfigurationSuite) TestConfigurationLists() {
+	fields := Fields{
+		"Config-Item": []string{
+			"Acquire::Languages::=en",
+			"Acquire::Languages::=de",
+			"Acquire::http::Proxy=http://proxy.example.com/with%20space",
+			"Acquire::http::Proxy=http://proxy.example.com/",
+			"APT::Key%3dWith%22Quotes=100%",
+		},
+	}
+	configuration := Configuration{}
+	suite.Require().NoError(UnmarshalFields(fields, configuration))
+	suite.Equal([]string{"en", "de"}, configuration.List("Acquire::Languages"))
+	suite.Equal([]string{"en", "de"}, configuration.List("Acquire::Languages::"))
+	suite.Equal("http://proxy.example.com/", configuration.Get("Acquire::http::Proxy"))
+	suite.Len(configuration["Acquire::http::Proxy"], 1)
+	suite.Equal("100%", configuration.Get(`APT::Key=With"Quotes`))
+	suite.Empty(configuration.Get("APT::Missing"))
+}
+
+func (suite *ConfigurationSuite) TestConfigurationPercentDecoding() {
+	suite.Equal("with space", dequoteString("with%20space"))
+	suite.Equal("line\nbreak", dequoteString("line%0abreak"))
+	suite.Equal("%zz%4", dequoteString("%zz%4"))
+}
+
+func (suite *ConfigurationSuite) TestConfigurationTree() {
+	configuration := Configuration{
+		"APT::Install-Recommends": {"false"},
+		"APT::Get::Assume-Yes":    {"true"},
+		"APT::Architectures::":    {"amd64", "arm64"},
+	}
+	tree := configuration.Tree()
+	suite.Require().NotNil(tree.Find("APT::Get::Assume-Yes"))
+	suite.Equal("true", tree.Find("APT::Get::Assume-Yes").Value)
+	suite.Equal("false", tree.Find("APT::Install-Recommends").Value)
+	architectures := tree.Find("APT::Architectures")
+	suite.Require().NotNil(architectures)
+	suite.Require().Len(architectures.Children, 2)
+	suite.Equal("amd64", architectures.Children[0].Value)
+	suite.Equal("arm64", architectures.Children[1].Value)
+	suite.Nil(tree.Find("APT::Missing"))
+}
+
+type HandshakeSuite struct {
+	suite.Suite
+}
+
+func (suite *HandshakeSuite) TestReceiveConfiguration() {
+	input := heredoc.Doc(`
+    601 Configuration
+    Config-Item: Acquire::s3::Timeout=30
+    Config-Item: APT::Architectures::=amd64,arm64
+
+    600 URI Acquire
+    URI: s3://bucket/dists/stable/Release
+    Filename: /var/lib/apt/lists/partial/Release
+    Last-Modified: Tue, 31 Mar 1998 00:00:00 GMT
+
+  `)
+	output := strings.Builder{}
+	type result struct {
+		writer  Configuration
+		context Configuration
+		request *Request
+	}
+	results := make(chan result, 1)
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(input), &output)),
+		WithHandlerFunction(func(writer *MessageWriter, request *Request) error {
+			results <- result{
+				writer:  writer.Configuration(),
+				context: ConfigurationFromContext(request.Context()),
+				request: request,
+			}
+			return nil
+		}))
+	suite.Require().NoError(err)
+	suite.Require().NoError(method.SendAndReceive())
+	suite.Equal("30", method.Configuration().Get("Acquire::s3::Timeout"))
+	suite.Equal([]string{"amd64,arm64"}, method.Configuration().List("APT::Architectures"))
+	suite.True(strings.HasPrefix(output.String(), "100 Capabilities\n"))
+	suite.Contains(output.String(), "Send-Config: true\n")
+	suite.Contains(output.String(), "Version: 1.0\n")
+	select {
+	case result := <-results:
+		suite.Equal("30", result.writer.Section("Acquire::s3").Get("Timeout"))
+		suite.Equal("30", result.context.Get("Acquire::s3::Timeout"))
+		suite.Equal("/var/lib/apt/lists/partial/Release", result.request.Target)
+		suite.Equal("bucket", result.request.Source.Host)
+		suite.Equal(1998, result.request.Modified.Year())
+	case <-time.After(time.Second):
+		suite.Fail("handler was not called")
+	}
+}
+
+func (suite *HandshakeSuite) TestConcurrentConfiguration() {
+	input := "601 Configuration\nConfig-Item: Acquire::s3::Timeout=30\nConfig-Item: Acquire::s3::Retries=3\n\n"
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(input), io.Discard)))
+	suite.Require().NoError(err)
+	returned := make(chan error, 1)
+	go func() { returned <- method.SendAndReceive() }()
+	for {
+		select {
+		case err := <-returned:
+			suite.Require().NoError(err)
+			suite.Equal("30", method.Configuration().Get("Acquire::s3::Timeout"))
+			return
+		default:
+			// Before the handshake completes, the configuration is empty; it is
+			// never seen partially filled.
+			if cfg := method.Configuration(); len(cfg) != 0 {
+				suite.Len(cfg, 2)
+			}
+		}
+	}
+}
+
+func (suite *HandshakeSuite) TestConfigurationTimeout() {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(reader, io.Discard)),
+		WithConfigurationTimeout(10*time.Millisecond))
+	suite.Require().NoError(err)
+	suite.ErrorIs(method.SendAndReceive(), ErrConfigurationTimeout)
+}
+
+func (suite *HandshakeSuite) TestConfigurationNotReceived() {
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(""), io.Discard)))
+	suite.Require().NoError(err)
+	suite.ErrorIs(method.SendAndReceive(), ErrConfigurationNotReceived)
+}
+
+func (suite *HandshakeSuite) TestUnexpectedMessage() {
+	input := "600 URI Acquire\nURI: s3://bucket/Release\n\n"
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(input), io.Discard)))
+	suite.Require().NoError(err)
+	suite.ErrorIs(method.SendAndReceive(), ErrUnexpectedMessage)
+}
+
 func TestHandshakeMessages(test *testing.T) {
 	suite.Run(test, new(ConfigurationSuite))
+	suite.Run(test, new(HandshakeSuite))
 }
@@ -0,0 +1,54 @@
+package transport
+
+import "time"
+
+// ModifiedSince reports whether a resource last modified at the given time
+// is newer than the copy APT already has (see [Request.Modified]), and must
+// therefore be transferred. It is true when APT has no copy, or the
+// modification time of the resource is unknown (i.e., zero).
+//
+// Times are compared to the second, as Last-Modified fields carry no
+// fractional seconds.
+func (request *Request) ModifiedSince(modified time.Time) bool {
+	if request.Modified.IsZero() || modified.IsZero() {
+		return true
+	}
+	return modified.Truncate(time.Second).After(request.Modified.Truncate(time.Second))
+}
+
+// NotModified sends a 201 URI Done with IMS-Hit set for the request, telling
+// APT that the copy it already has is current, so that nothing is
+// transferred. It may be called after any check, such as comparing an ETag,
+// or a 304 Not Modified from a server.
+func (writer *MessageWriter) NotModified(request *Request) error {
+	done := &URIDone{
+		URI:      requestURI(request),
+		Filename: request.Target,
+		IMSHit:   "true",
+	}
+	if !request.Modified.IsZero() {
+		done.LastModified = formatTime(request.Modified)
+	}
+	message, err := done.MarshalMessage()
+	if err != nil {
+		return err
+	}
+	// Nothing was transferred, so there is no size to report.
+	message.Fields.Del("Size")
+	return writer.Write(message)
+}
+
+// IfModifiedSince sends a 201 URI Done with IMS-Hit set, and returns true, if
+// a resource last modified at the given time is not newer than the copy APT
+// already has (see [Request.ModifiedSince]). Otherwise, it returns false and
+// the handler should go ahead with the transfer:
+//
+//	if hit, err := writer.IfModifiedSince(request, modified); hit || err != nil {
+//		return err
+//	}
+func (writer *MessageWriter) IfModifiedSince(request *Request, modified time.Time) (bool, error) {
+	if request.ModifiedSince(modified) {
+		return false, nil
+	}
+	return true, writer.NotModified(request)
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type IMSSuite struct {
+	suite.Suite
+}
+
+func (suite *IMSSuite) TestModifiedSince() {
+	cached := time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+	request := &Request{Modified: cached}
+	suite.False(request.ModifiedSince(cached))
+	suite.False(request.ModifiedSince(cached.Add(500 * time.Millisecond)))
+	suite.False(request.ModifiedSince(cached.In(time.FixedZone("CET", 3600))))
+	suite.True(request.ModifiedSince(cached.Add(time.Second)))
+	suite.True(request.ModifiedSince(time.Time{}))
+	suite.True((&Request{}).ModifiedSince(cached))
+}
+
+func (suite *IMSSuite) TestIfModifiedSince() {
+	buffer := strings.Builder{}
+	writer := NewMessageWriter(&buffer)
+	request := newTestRequest()
+	request.Target = "/tmp/Release"
+	request.Modified = time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+
+	hit, err := writer.IfModifiedSince(request, request.Modified.Add(time.Hour))
+	suite.Require().NoError(err)
+	suite.False(hit)
+	suite.Empty(buffer.String())
+
+	hit, err = writer.IfModifiedSince(request, request.Modified)
+	suite.Require().NoError(err)
+	suite.True(hit)
+	suite.Equal("201 URI Done\nFilename: /tmp/Release\nIms-Hit: true\nLast-Modified: Fri, 01 Mar 2024 12:30:00 GMT\nUri: s3://bucket/Release\n\n", buffer.String())
+}
+
+func (suite *IMSSuite) TestLastModified() {
+	// APT sends Last-Modified in GMT, which is parsed as UTC whatever the
+	// local zone is.
+	message := &Message{StatusCode: StatusCodeURIAcquire, Summary: "URI Acquire", Fields: Fields{}}
+	message.Fields.Set("URI", "s3://bucket/Release")
+	message.Fields.Set("Last-Modified", "Fri, 01 Mar 2024 12:30:00 GMT")
+	request := &Request{}
+	suite.Require().NoError(UnmarshalMessage(message, request))
+	suite.Equal(time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC), request.Modified)
+}
+
+func (suite *IMSSuite) TestMethod() {
+	method, recorder := newRecordedMethod(suite.T(),
+		WithHandlerFunction(func(writer *MessageWriter, request *Request) error {
+			hit, err := writer.IfModifiedSince(request, request.Modified)
+			if hit || err != nil {
+				return err
+			}
+			return os.WriteFile(request.Target, []byte("hello world"), 0o644)
+		}))
+	request := newTestRequest()
+	request.Target = filepath.Join(suite.T().TempDir(), "Release")
+	request.Modified = time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+	// The target does not exist, so hash verification must not run.
+	request.ExpectedSHA256 = helloWorldSHA256
+	method.serve(request)
+	suite.Contains(<-recorder, "\nIms-Hit: true\n")
+	suite.Empty(recorder)
+	suite.NoFileExists(request.Target)
+}
+
+func TestIMS(test *testing.T) {
+	suite.Run(test, new(IMSSuite))
+}
@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LogHandlerOptions configures the [slog.Handler] returned by
+// [Method.LogHandler].
+type LogHandlerOptions struct {
+	// Scheme is the scheme whose Debug::Acquire::<scheme> setting enables
+	// debug records. By default, it is the name the method was run as, which
+	// is how APT picks a method for a scheme.
+	Scheme string
+	// Level, when set, is the minimum level of records that are sent, instead
+	// of the level chosen from the configuration.
+	Level slog.Leveler
+}
+
+// WithDefaultLogHandler installs the [Method.LogHandler] of the Method as the
+// handler of the [slog.Default] logger, so that anything logged through
+// log/slog (or the log package) is sent to APT as a message, instead of
+// corrupting the stream.
+//
+// The handler is installed by [Method.SendAndReceive] once the handshake has
+// completed, and the previous default logger is restored before it returns.
+func WithDefaultLogHandler(options *LogHandlerOptions) MethodOption {
+	return func(method *Method) error {
+		method.defaultLogHandler = options
+		if options == nil {
+			method.defaultLogHandler = &LogHandlerOptions{}
+		}
+		return nil
+	}
+}
+
+// LogHandler returns a [slog.Handler] that sends each record to APT as a
+// message. Records below [slog.LevelInfo] are sent as 101 Log messages,
+// records below [slog.LevelWarn] as 102 Status messages, and any other record
+// as a 104 Warning.
+//
+// APT only shows 101 Log messages when debugging a method, so debug records
+// are dropped unless Debug::Acquire::<scheme> is enabled in the configuration
+// APT sent. Until the configuration has been received, debug records are
+// dropped.
+//
+// A record is rendered as its message followed by its attributes, in the
+// key=value format of [slog.TextHandler], on a single line.
+func (method *Method) LogHandler(options *LogHandlerOptions) slog.Handler {
+	handler := &logHandler{method: method}
+	if options != nil {
+		handler.options = *options
+	}
+	if handler.options.Scheme == "" {
+		handler.options.Scheme = filepath.Base(os.Args[0])
+	}
+	return handler
+}
+
+// installLogHandler makes the log handler the process default, and returns a
+// function that restores the previous default.
+func (method *Method) installLogHandler() (restore func()) {
+	previous := slog.Default()
+	// Setting a handler also redirects the log package, which restoring the
+	// previous default logger does not undo.
+	output, flags := log.Writer(), log.Flags()
+	slog.SetDefault(slog.New(method.LogHandler(method.defaultLogHandler)))
+	return func() {
+		slog.SetDefault(previous)
+		log.SetOutput(output)
+		log.SetFlags(flags)
+	}
+}
+
+type logHandler struct {
+	method  *Method
+	options LogHandlerOptions
+	prefix  string
+	attrs   string
+}
+
+func (handler *logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if handler.options.Level != nil {
+		return level >= handler.options.Level.Level()
+	}
+	if level >= slog.LevelInfo {
+		return true
+	}
+	cfg := handler.method.configuration.Load()
+	if cfg == nil {
+		return false
+	}
+	enabled, err := parseAPTBool(cfg.Get("Debug::Acquire::" + handler.options.Scheme))
+	return err == nil && enabled
+}
+
+func (handler *logHandler) Handle(_ context.Context, record slog.Record) error {
+	text := strings.Builder{}
+	text.WriteString(record.Message)
+	text.WriteString(handler.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		appendLogAttr(&text, handler.prefix, attr)
+		return true
+	})
+	// A message field cannot span several lines.
+	line := strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(text.String())
+	var message *Message
+	var err error
+	switch {
+	case record.Level < slog.LevelInfo:
+		message, err = Log(line).MarshalMessage()
+	case record.Level < slog.LevelWarn:
+		message, err = Status(line).MarshalMessage()
+	default:
+		message, err = Warning(line).MarshalMessage()
+	}
+	if err != nil {
+		return err
+	}
+	return NewMessageWriter(handler.method.output).Write(message)
+}
+
+func (handler *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *handler
+	text := strings.Builder{}
+	text.WriteString(handler.attrs)
+	for _, attr := range attrs {
+		appendLogAttr(&text, handler.prefix, attr)
+	}
+	clone.attrs = text.String()
+	return &clone
+}
+
+func (handler *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return handler
+	}
+	clone := *handler
+	clone.prefix = handler.prefix + name + "."
+	return &clone
+}
+
+// appendLogAttr renders the attribute as " key=value", flattening groups.
+func appendLogAttr(text *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			appendLogAttr(text, prefix, member)
+		}
+		return
+	}
+	value := attr.Value.String()
+	if value == "" || strings.ContainsFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '=' || !strconv.IsPrint(r)
+	}) {
+		value = strconv.Quote(value)
+	}
+	text.WriteString(" " + prefix + attr.Key + "=" + value)
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LogSuite struct {
+	suite.Suite
+}
+
+func (suite *LogSuite) TestLevels() {
+	method, recorder := newRecordedMethod(suite.T())
+	logger := slog.New(method.LogHandler(&LogHandlerOptions{Level: slog.LevelDebug}))
+	logger.Debug("connecting", "host", "example.com")
+	suite.Equal("101 Log\nMessage: connecting host=example.com\n\n", <-recorder)
+	logger.Info("connected")
+	suite.Equal("102 Status\nMessage: connected\n\n", <-recorder)
+	logger.Warn("slow\nmirror")
+	suite.Equal("104 Warning\nMessage: slow mirror\n\n", <-recorder)
+	logger.Error("failed", "err", "connection reset")
+	suite.Equal("104 Warning\nMessage: failed err=\"connection reset\"\n\n", <-recorder)
+}
+
+func (suite *LogSuite) TestDebugConfiguration() {
+	method, recorder := newRecordedMethod(suite.T())
+	handler := method.LogHandler(&LogHandlerOptions{Scheme: "s3"})
+	suite.False(handler.Enabled(context.Background(), slog.LevelDebug))
+	suite.True(handler.Enabled(context.Background(), slog.LevelInfo))
+
+	cfg := Configuration{"Debug::Acquire::s3": {"true"}}
+	method.configuration.Store(&cfg)
+	suite.True(handler.Enabled(context.Background(), slog.LevelDebug))
+	suite.False(method.LogHandler(&LogHandlerOptions{Scheme: "http"}).Enabled(context.Background(), slog.LevelDebug))
+
+	slog.New(handler).Debug("listing bucket")
+	suite.Equal("101 Log\nMessage: listing bucket\n\n", <-recorder)
+}
+
+func (suite *LogSuite) TestAttrs() {
+	method, recorder := newRecordedMethod(suite.T())
+	logger := slog.New(method.LogHandler(nil)).With("uri", "s3://bucket/Release").WithGroup("http")
+	logger.Info("response", "status", 200, slog.Group("header", "etag", `"abc"`))
+	suite.Equal("102 Status\nMessage: response uri=s3://bucket/Release http.status=200 http.header.etag=\"\\\"abc\\\"\"\n\n", <-recorder)
+}
+
+func (suite *LogSuite) TestDefault() {
+	previous, output := slog.Default(), log.Writer()
+	input := "601 Configuration\n\n600 URI Acquire\nURI: s3://bucket/Release\nFilename: /tmp/Release\n\n"
+	recorder := make(messageRecorder, 10)
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(input), recorder)),
+		WithDefaultLogHandler(nil),
+		WithHandlerFunction(func(*MessageWriter, *Request) error {
+			slog.Info("installed")
+			log.Print("redirected")
+			return nil
+		}))
+	suite.Require().NoError(err)
+	suite.Same(previous, slog.Default())
+	suite.Require().NoError(method.SendAndReceive())
+	suite.Contains(<-recorder, "100 Capabilities\n")
+	suite.Equal("102 Status\nMessage: installed\n\n", <-recorder)
+	suite.Equal("102 Status\nMessage: redirected\n\n", <-recorder)
+	suite.Contains(<-recorder, "201 URI Done\n")
+	suite.Same(previous, slog.Default())
+	suite.Equal(output, log.Writer())
+}
+
+func TestLog(test *testing.T) {
+	suite.Run(test, new(LogSuite))
+}
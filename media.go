@@ -1,5 +1,11 @@
 package transport
 
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
 // MediaFailure (status code 403) indicates new media must be inserted.
 //
 // This method is executed primarily when the transport method deals with
@@ -14,8 +20,177 @@ type MediaFailure struct {
 // message.
 //
 // This message is sent in response to a 403 Media Failure message. It
-// indicates the user has changed media and it is safe to proceed.
+// indicates the user has changed media and it is safe to proceed. When
+// [transport.MediaChanged.Fail] is set, the user declined to change the media.
+//
+// APT sends the reply without any fields when the media was changed, and only
+// a Failed field when it was not.
 type MediaChanged struct {
 	Media string
-	Fail  string
+	Fail  bool `transport:"Failed"`
+}
+
+func (failure *MediaFailure) MarshalMessage() (*Message, error) {
+	fields, err := MarshalFields(failure)
+	if err != nil {
+		return nil, err
+	}
+	message := &Message{
+		StatusCode: StatusCodeMediaFailure,
+		Summary:    "Media Failure",
+		Fields:     fields,
+	}
+	return message, nil
+}
+
+func (changed *MediaChanged) UnmarshalMessage(message *Message) error {
+	if message.StatusCode != StatusCodeMediaChanged {
+		return fmt.Errorf("%w: expected %q, received %q", ErrUnexpectedMessage, StatusText(StatusCodeMediaChanged), StatusText(message.StatusCode))
+	}
+	return UnmarshalFields(message.Fields, changed)
+}
+
+// RequireMedia asks APT to have the user insert the given media, and waits
+// for the 603 Media Changed reply. This is how methods advertising
+// [transport.Capabilities.Removable] switch between discs.
+//
+// While waiting, every other handler of the [Method] is paused the next time
+// it reaches a safe point: when it writes a message, or calls
+// [MessageWriter.Checkpoint]. No new requests are started until the reply
+// arrives. Only one handler may wait for media at a time; concurrent calls
+// wait their turn.
+//
+// If the user declined to change the media, the reply is returned together
+// with an error wrapping [ErrMediaNotChanged].
+func (writer *MessageWriter) RequireMedia(ctx context.Context, failure MediaFailure) (MediaChanged, error) {
+	if writer.media == nil {
+		return MediaChanged{}, ErrNoMethod
+	}
+	return writer.media.require(ctx, writer, &failure)
+}
+
+// Checkpoint marks a safe point in a handler. If another handler is waiting
+// for media (see [MessageWriter.RequireMedia]), Checkpoint blocks until the
+// media has changed, or the context is done.
+//
+// Handlers that do long stretches of work without writing any messages should
+// call Checkpoint regularly.
+func (writer *MessageWriter) Checkpoint(ctx context.Context) error {
+	if writer.media == nil {
+		return nil
+	}
+	return writer.media.wait(ctx, writer)
+}
+
+// mediaCoordinator pauses a [Method]'s handlers while one of them waits for
+// APT to reply to a 403 Media Failure.
+type mediaCoordinator struct {
+	turn      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	mutex     sync.Mutex
+	owner     *MessageWriter
+	resumed   chan struct{}
+	changed   chan MediaChanged
+	scheduler *scheduler
+}
+
+func newMediaCoordinator(scheduler *scheduler) *mediaCoordinator {
+	return &mediaCoordinator{
+		turn:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		scheduler: scheduler,
+	}
+}
+
+func (media *mediaCoordinator) require(ctx context.Context, writer *MessageWriter, failure *MediaFailure) (MediaChanged, error) {
+	select {
+	case media.turn <- struct{}{}:
+	case <-media.done:
+		return MediaChanged{}, ErrMethodShutdown
+	case <-ctx.Done():
+		return MediaChanged{}, ctx.Err()
+	}
+	defer func() { <-media.turn }()
+	changed := media.pause(writer)
+	defer media.resume()
+	message, err := MarshalMessage(failure)
+	if err != nil {
+		return MediaChanged{}, err
+	}
+	if err := writer.Write(message); err != nil {
+		return MediaChanged{}, err
+	}
+	writer.metrics.recordPrompt("media")
+	select {
+	case reply := <-changed:
+		if reply.Fail {
+			return reply, fmt.Errorf("%w: %s", ErrMediaNotChanged, failure.Media)
+		}
+		return reply, nil
+	case <-media.done:
+		return MediaChanged{}, ErrMethodShutdown
+	case <-ctx.Done():
+		return MediaChanged{}, ctx.Err()
+	}
+}
+
+// pause makes writer the only handler allowed past a safe point, and returns
+// the channel its reply will be delivered on.
+func (media *mediaCoordinator) pause(writer *MessageWriter) <-chan MediaChanged {
+	media.mutex.Lock()
+	defer media.mutex.Unlock()
+	media.owner = writer
+	media.resumed = make(chan struct{})
+	media.changed = make(chan MediaChanged, 1)
+	media.scheduler.pause()
+	return media.changed
+}
+
+func (media *mediaCoordinator) resume() {
+	media.mutex.Lock()
+	defer media.mutex.Unlock()
+	close(media.resumed)
+	media.owner, media.resumed, media.changed = nil, nil, nil
+	media.scheduler.resume()
+}
+
+// deliver hands a 603 Media Changed to the handler waiting for it. It
+// reports whether any handler was waiting.
+func (media *mediaCoordinator) deliver(reply MediaChanged) bool {
+	media.mutex.Lock()
+	defer media.mutex.Unlock()
+	if media.changed == nil {
+		return false
+	}
+	select {
+	case media.changed <- reply:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait blocks while a handler other than writer is waiting for media.
+func (media *mediaCoordinator) wait(ctx context.Context, writer *MessageWriter) error {
+	media.mutex.Lock()
+	resumed, owner := media.resumed, media.owner
+	media.mutex.Unlock()
+	if resumed == nil || owner == writer {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-media.done:
+		return ErrMethodShutdown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close releases every paused handler, and makes any further media requests
+// fail with [ErrMethodShutdown].
+func (media *mediaCoordinator) close() {
+	media.closeOnce.Do(func() { close(media.done) })
 }
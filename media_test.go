@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MediaSuite struct {
+	suite.Suite
+}
+
+// next reads the next message sent by the method, failing the test if none
+// arrives in time.
+func (suite *MediaSuite) next(messages <-chan *Message) *Message {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(time.Second):
+		suite.FailNow("no message was sent")
+		return nil
+	}
+}
+
+func (suite *MediaSuite) TestRequireMedia() {
+	input, toMethod := io.Pipe()
+	fromMethod, output := io.Pipe()
+	defer toMethod.Close()
+	type result struct {
+		changed MediaChanged
+		err     error
+	}
+	results := make(chan result)
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(input, output)),
+		WithCapabilities(Capabilities{Removable: true}),
+		WithHandlerFunction(func(writer *MessageWriter, request *Request) error {
+			changed, err := writer.RequireMedia(request.Context(), MediaFailure{Media: "Disc 2", Drive: "/media/cdrom"})
+			results <- result{changed, err}
+			return err
+		}))
+	suite.Require().NoError(err)
+	go method.SendAndReceive()
+	messages := make(chan *Message)
+	go func() {
+		scanner := NewMessageScanner(fromMethod)
+		for scanner.Scan() {
+			message, _ := scanner.Message()
+			messages <- message
+		}
+	}()
+	suite.Equal(StatusCodeCapabilities, suite.next(messages).StatusCode)
+	io.WriteString(toMethod, "601 Configuration\n\n600 URI Acquire\nURI: cdrom://disc/Release\nFilename: /tmp/Release\n\n")
+
+	message := suite.next(messages)
+	suite.Equal(StatusCodeMediaFailure, message.StatusCode)
+	suite.Equal("Disc 2", message.Fields.Get("Media"))
+	suite.Equal("/media/cdrom", message.Fields.Get("Drive"))
+	// These are the exact replies APT sends, see acquire-worker.cc.
+	io.WriteString(toMethod, "603 Media Changed\n\n")
+	first := <-results
+	suite.NoError(first.err)
+	suite.Equal(MediaChanged{}, first.changed)
+	suite.Equal(StatusCodeURIDone, suite.next(messages).StatusCode)
+
+	io.WriteString(toMethod, "600 URI Acquire\nURI: cdrom://disc/InRelease\nFilename: /tmp/InRelease\n\n")
+	suite.Equal(StatusCodeMediaFailure, suite.next(messages).StatusCode)
+	io.WriteString(toMethod, "603 Media Changed\nFailed: true\n\n")
+	second := <-results
+	suite.ErrorIs(second.err, ErrMediaNotChanged)
+	suite.True(second.changed.Fail)
+	suite.Equal(StatusCodeURIFailure, suite.next(messages).StatusCode)
+}
+
+func (suite *MediaSuite) TestPauseHandlers() {
+	server := newBlockingServer()
+	scheduler := newScheduler(10, 10, func(*Request) int { return 1 }, server.serve)
+	media := newMediaCoordinator(scheduler)
+	owner := &MessageWriter{inner: io.Discard, media: media}
+	other := &MessageWriter{inner: io.Discard, media: media}
+
+	replied := make(chan error)
+	go func() {
+		_, err := owner.RequireMedia(context.Background(), MediaFailure{Media: "Disc 2"})
+		replied <- err
+	}()
+	suite.Eventually(func() bool {
+		media.mutex.Lock()
+		defer media.mutex.Unlock()
+		return media.changed != nil
+	}, time.Second, time.Millisecond)
+
+	checkpoint := make(chan error)
+	go func() { checkpoint <- other.Checkpoint(context.Background()) }()
+	suite.Require().NoError(scheduler.submit(context.Background(), newSchedulerRequest("cdrom://disc/Release")))
+	select {
+	case <-checkpoint:
+		suite.FailNow("checkpoint did not wait for the media to change")
+	case <-server.running:
+		suite.FailNow("request was started while waiting for the media to change")
+	case <-time.After(20 * time.Millisecond):
+	}
+	suite.True(media.deliver(MediaChanged{Media: "Disc 2"}))
+	suite.NoError(<-replied)
+	suite.NoError(<-checkpoint)
+	suite.Equal("cdrom://disc/Release", <-server.running)
+	close(server.release)
+	scheduler.wait()
+}
+
+func (suite *MediaSuite) TestWithoutMethod() {
+	writer := NewMessageWriter(io.Discard)
+	_, err := writer.RequireMedia(context.Background(), MediaFailure{Media: "Disc 2"})
+	suite.ErrorIs(err, ErrNoMethod)
+	suite.NoError(writer.Checkpoint(context.Background()))
+}
+
+func TestMedia(test *testing.T) {
+	suite.Run(test, new(MediaSuite))
+}
@@ -3,6 +3,8 @@ package transport
 import (
 	"bytes"
 	"fmt"
+	"reflect"
+	"strconv"
 )
 
 const (
@@ -93,13 +95,35 @@ func StatusText(code int) string {
 	return ""
 }
 
+// MarshalMessage returns the [Message] representation of the value provided.
+//
+// Only values that implement the [MessageMarshaler] interface can currently be
+// marshaled, as the status code of a message cannot be inferred from an
+// arbitrary type.
+//
 // todo: support passing in an `error` and converting it to a [Message]
 func MarshalMessage(value any) (*Message, error) {
-	return nil, ErrNotImplemented
+	if mm, ok := value.(MessageMarshaler); ok {
+		return mm.MarshalMessage()
+	}
+	return nil, &MessageMarshalerError{
+		Type:   reflect.TypeOf(value),
+		Err:    ErrNotImplemented,
+		source: "MarshalMessage",
+	}
 }
 
+// UnmarshalMessage decodes the provided [Message] into the destination.
+//
+// If the destination implements the [MessageUnmarshaler] interface, it is used
+// directly. Otherwise, the [Fields] of the message are decoded into the
+// destination with [UnmarshalFields]. The status code of the message is NOT
+// checked in the latter case.
 func UnmarshalMessage(message *Message, destination any) error {
-	return ErrNotImplemented
+	if mu, ok := destination.(MessageUnmarshaler); ok {
+		return mu.UnmarshalMessage(message)
+	}
+	return UnmarshalFields(message.Fields, destination)
 }
 
 // MarshalBinary serializes the receiving Message into a byte slice.
@@ -124,14 +148,22 @@ func (message *Message) MarshalBinary() ([]byte, error) {
 // This function is dependent on the behavior of Unmarshalling a [Fields]
 // object.
 func (message *Message) UnmarshalBinary(data []byte) error {
-	before, after, found := bytes.Cut(data, []byte("\n"))
-	if !found {
+	// A message may be only a header (e.g., a bare 603 Media Changed), in
+	// which case there is no newline after it.
+	before, after, _ := bytes.Cut(data, []byte("\n"))
+	if len(bytes.TrimSpace(before)) == 0 {
 		return ErrMessageHeaderNotFound
 	}
 	items := bytes.SplitN(before, []byte(" "), 2)
 	if len(items) != 2 {
 		return fmt.Errorf("%w %q", ErrMessageHeaderMalformed, string(before))
 	}
+	code, err := strconv.Atoi(string(items[0]))
+	if err != nil {
+		return fmt.Errorf("%w %q", ErrMessageHeaderMalformed, string(before))
+	}
+	message.StatusCode = code
+	message.Summary = string(items[1])
 	if message.Fields == nil {
 		message.Fields = make(Fields)
 	}
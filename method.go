@@ -2,9 +2,18 @@ package transport
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/url"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // A Handler responds to a URI Acquire message.
@@ -16,17 +25,86 @@ type Request struct {
 	Modified time.Time `transport:"Last-Modified"`
 	Source   *url.URL  `transport:"URI"`
 	Target   string    `transport:"Filename"`
+	// The hashes APT expects the target to have, if any. The target is
+	// verified against them when the 201 URI Done is written, whether by the
+	// handler or by the Method (see [SkipHashVerification]).
+	ExpectedMD5Sum string `transport:"Expected-MD5Sum"`
+	ExpectedSHA1   string `transport:"Expected-SHA1"`
+	ExpectedSHA256 string `transport:"Expected-SHA256"`
+	ExpectedSHA512 string `transport:"Expected-SHA512"`
+	ctx            context.Context
+	uri            string
 }
 
 type HandlerFunc func(*MessageWriter, *Request) error
 type MethodOption func(*Method) error
 
+// Method implements the APT side of the transport method protocol, passing
+// each URI Acquire it receives to its Handler.
+//
+// When [transport.Capabilities.Pipeline] is advertised, APT may send several
+// requests before the first one is finished. A Method will run up to
+// the pipeline depth of requests for the same host at once (see
+// [WithPipelineDepth]), and no more than the concurrency limit overall (see
+// [WithConcurrencyLimit]). Requests beyond either limit are queued. Requests
+// for the same host are started in the order APT sent them, but may complete
+// in any order, which APT permits. Without pipelining, requests for the same
+// host are handled one at a time.
+//
+// A Method shuts down gracefully (see [Method.Shutdown]) when APT closes its
+// input, when its context is cancelled, or when it receives one of the
+// signals given to [WithShutdownSignals].
 type Method struct {
-	stream       *Stream
-	capabilities Capabilities
-	requests     chan *Request
-	ctx          context.Context
-	Handler      Handler
+	stream               *Stream
+	output               *syncWriter
+	capabilities         Capabilities
+	configuration        atomic.Pointer[Configuration]
+	configurationTimeout time.Duration
+	pipelineDepth        int
+	concurrencyLimit     int
+	queueDepth           int
+	scheduler            *scheduler
+	media                *mediaCoordinator
+	authorization        *authorizationBroker
+	aux                  *auxBroker
+	shutdownTimeout      time.Duration
+	shutdownSignals      []os.Signal
+	cleanups             []func() error
+	closing              chan struct{}
+	closeOnce            sync.Once
+	stopped              chan struct{}
+	stopOnce             sync.Once
+	stopErr              error
+	inflight             map[*Request]*MessageWriter
+	inflightMutex        sync.Mutex
+	requestCtx           context.Context
+	cancelRequests       context.CancelFunc
+	tracer               trace.Tracer
+	meterProvider        metric.MeterProvider
+	metrics              *methodMetrics
+	defaultLogHandler    *LogHandlerOptions
+	stdoutStatusCode     int
+	middlewares          []Middleware
+	ctx                  context.Context
+	Handler              Handler
+}
+
+// DefaultConfigurationTimeout is how long a [Method] will wait for APT to send
+// the 601 Configuration message during the handshake, unless changed with
+// [WithConfigurationTimeout].
+const DefaultConfigurationTimeout = 30 * time.Second
+
+// Context returns the request's context. The context carries the
+// [Configuration] sent by APT, which can be retrieved with
+// [ConfigurationFromContext].
+//
+// The returned context is always non-nil; it defaults to the background
+// context.
+func (request *Request) Context() context.Context {
+	if request.ctx != nil {
+		return request.ctx
+	}
+	return context.Background()
 }
 
 // WithCapabilities sets the [transport.Capabilities] of the [Method].
@@ -58,6 +136,52 @@ func WithStream(stream *Stream) MethodOption {
 	}
 }
 
+// WithConfigurationTimeout sets how long the [Method] waits for the 601
+// Configuration message after sending its [transport.Capabilities].
+func WithConfigurationTimeout(timeout time.Duration) MethodOption {
+	return func(method *Method) error {
+		method.configurationTimeout = timeout
+		return nil
+	}
+}
+
+// WithPipelineDepth sets how many requests for a single host the [Method]
+// will handle at once, when [transport.Capabilities.Pipeline] is set.
+//
+// By default, the depth is taken from Acquire::<scheme>::Pipeline-Depth (see
+// [Configuration.ForHost]), falling back to [DefaultPipelineDepth].
+func WithPipelineDepth(depth int) MethodOption {
+	return func(method *Method) error {
+		method.pipelineDepth = depth
+		return nil
+	}
+}
+
+// WithConcurrencyLimit sets how many requests the [Method] will handle at
+// once across all hosts. The default is [DefaultConcurrencyLimit].
+func WithConcurrencyLimit(limit int) MethodOption {
+	return func(method *Method) error {
+		method.concurrencyLimit = limit
+		return nil
+	}
+}
+
+// WithQueueDepth sets how many requests the [Method] will hold while they
+// wait to be started. The default is [DefaultQueueDepth].
+//
+// While requests wait in the queue, the Method continues to read its input,
+// so that replies to messages sent by running handlers (e.g., 602
+// Authorization Credentials) are still received. Once the queue is full,
+// reading stops until a request is started, applying backpressure to APT. The
+// depth should therefore be larger than the number of requests APT pipelines
+// to the Method.
+func WithQueueDepth(depth int) MethodOption {
+	return func(method *Method) error {
+		method.queueDepth = depth
+		return nil
+	}
+}
+
 // WithHandler sets the [transport.Method.Handler]
 func WithHandler(handler Handler) MethodOption {
 	return func(method *Method) error {
@@ -68,15 +192,39 @@ func WithHandler(handler Handler) MethodOption {
 
 func NewMethod(ctx context.Context, version string, options ...MethodOption) (*Method, error) {
 	method := &Method{
-		stream:   NewStream(),
-		requests: make(chan *Request),
-		ctx:      ctx,
+		stream:               NewStream(),
+		configurationTimeout: DefaultConfigurationTimeout,
+		concurrencyLimit:     DefaultConcurrencyLimit,
+		queueDepth:           DefaultQueueDepth,
+		shutdownTimeout:      DefaultShutdownTimeout,
+		closing:              make(chan struct{}),
+		stopped:              make(chan struct{}),
+		inflight:             map[*Request]*MessageWriter{},
+		tracer:               tracer,
+		ctx:                  ctx,
 	}
 	for _, option := range options {
 		if err := option(method); err != nil {
 			return nil, err
 		}
 	}
+	metrics, err := newMethodMetrics(method.meterProvider)
+	if err != nil {
+		return nil, err
+	}
+	method.metrics = metrics
+	method.output = &syncWriter{inner: method.stream}
+	method.scheduler = newScheduler(method.concurrencyLimit, method.queueDepth, method.depth, method.serve)
+	method.scheduler.waited = method.metrics.recordQueueWait
+	method.media = newMediaCoordinator(method.scheduler)
+	method.authorization = newAuthorizationBroker()
+	method.aux = newAuxBroker(method.capabilities.AuxRequests)
+	// Requests outlive the Method's context, so that they may finish while the
+	// Method shuts down.
+	method.requestCtx, method.cancelRequests = context.WithCancel(context.WithoutCancel(ctx))
+	if len(method.cleanups) != 0 {
+		method.capabilities.NeedsCleanup = true
+	}
 	// These are ALWAYS set.
 	method.capabilities.SendConfig = true
 	method.capabilities.Version = version
@@ -84,105 +232,303 @@ func NewMethod(ctx context.Context, version string, options ...MethodOption) (*M
 	return method, nil
 }
 
+// Configuration returns a copy of the configuration sent to the Method from
+// APT during the handshake. Before the handshake has completed, an empty
+// Configuration is returned.
+func (method *Method) Configuration() Configuration {
+	return method.config().Clone()
+}
+
+// config returns the configuration received during the handshake, which
+// must not be modified, or an empty Configuration before then.
+func (method *Method) config() Configuration {
+	if cfg := method.configuration.Load(); cfg != nil {
+		return *cfg
+	}
+	return Configuration{}
+}
+
+// QueueStats returns a snapshot of the Method's request queue, including how
+// many requests are waiting, and how long requests have waited to be started.
+func (method *Method) QueueStats() QueueStats {
+	return method.scheduler.snapshot()
+}
+
 // SendAndReceive is the Method's main loop, and can be considered equivalent
 // to [net/http.Server.ListenAndServe].
 //
 // This function will perform the initial handshake, launch an event queue, and
-// then block on stdin, until it is closed, cannot be read from any longer, or
-// the context is cancelled.
+// then block on the Method's input stream, until it is closed, cannot be read
+// from any longer, or the Method is shut down. The Method is then shut down
+// gracefully, giving running handlers the time set by [WithShutdownTimeout]
+// to finish (see [Method.Shutdown]). When APT closes the input, requests that
+// are still queued are run within that time as well.
 //
-// NOTE(bruxisma): The use of [context.Context] is currently barebones, and
-// will most likely improve over time.
-func (method *Method) SendAndReceive() error {
-	// TODO(bruxisma): Should we create a "root" span here?
-	scanner := NewMessageScanner(os.Stdin)
-	if err := method.handshake(); err != nil {
+// When APT closes the input, the error returned is nil, unless reading the
+// input failed or handlers had to be abandoned. When the Method was shut
+// down with [Method.Shutdown] or a signal, the error wraps
+// [ErrMethodShutdown], and when the context was cancelled, it wraps the
+// context's error.
+func (method *Method) SendAndReceive() (err error) {
+	guard, err := method.guardStdout()
+	if err != nil {
 		return err
 	}
+	// Every way out of SendAndReceive stops the Method first, so nothing is
+	// left to write to the guarded stdout.
+	defer func() { err = errors.Join(err, guard.restore()) }()
 	ctx, cancel := context.WithCancel(method.ctx)
 	defer cancel()
-	go method.handleRequests(ctx)
-	for scanner.Scan() {
-		message, err := scanner.Message()
-		if err != nil {
+	started := time.Now()
+	messages, errs := method.receive(ctx, NewMessageScanner(method.stream))
+	handshakeErr := method.handshake(ctx, messages, errs)
+	ctx, span := method.tracer.Start(traceParent(ctx, method.config()), "apt.method",
+		trace.WithTimestamp(started),
+		trace.WithAttributes(attribute.String("apt.method.version", method.capabilities.Version)))
+	defer func() { endSpan(span, err) }()
+	method.traceHandshake(ctx, started, handshakeErr)
+	if handshakeErr != nil {
+		method.metrics.recordProtocolError("handshake", handshakeErr)
+		return errors.Join(handshakeErr, method.stopWithTimeout(false))
+	}
+	if method.defaultLogHandler != nil {
+		defer method.installLogHandler()()
+	}
+	requestCtx := context.WithValue(method.requestCtx, configurationKey{}, method.config())
+	requestCtx = trace.ContextWithSpan(requestCtx, span)
+	var signals chan os.Signal
+	if len(method.shutdownSignals) != 0 {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, method.shutdownSignals...)
+		defer signal.Stop(signals)
+	}
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				err := <-errs
+				method.metrics.recordProtocolError("receive", err)
+				return errors.Join(method.stopWithTimeout(true), err)
+			}
+			if err := method.dispatch(ctx, requestCtx, message); errors.Is(err, ErrMethodShutdown) {
+				<-method.stopped
+				return ErrMethodShutdown
+			} else if err != nil {
+				method.metrics.recordProtocolError("dispatch", err)
+				return errors.Join(err, method.stopWithTimeout(false))
+			}
+		case <-method.closing:
+			<-method.stopped
+			return ErrMethodShutdown
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), method.stopWithTimeout(false))
+		case sig := <-signals:
+			return errors.Join(fmt.Errorf("%w: received signal %s", ErrMethodShutdown, sig), method.stopWithTimeout(false))
+		}
+	}
+}
+
+// dispatch handles a single message received from APT after the handshake.
+// URI Acquire messages are queued as requests, and replies to messages sent by
+// handlers (including the URI Acquire answering an Aux Request) are routed
+// back to the handler waiting for them.
+func (method *Method) dispatch(ctx, requestCtx context.Context, message *Message) error {
+	switch message.StatusCode {
+	case StatusCodeURIAcquire:
+		if method.aux.deliver(message.Fields.Get("URI"), message.Fields.Get("Filename")) {
+			return nil
+		}
+		request := &Request{ctx: requestCtx}
+		if err := UnmarshalMessage(message, request); err != nil {
 			return err
 		}
-		switch message.StatusCode {
-		case 600:
-			request := &Request{}
-			if err := UnmarshalMessage(message, request); err != nil {
-				return err
-			}
-			method.requests <- request
+		return method.scheduler.submit(ctx, request)
+	case StatusCodeMediaChanged:
+		changed := MediaChanged{}
+		if err := UnmarshalMessage(message, &changed); err != nil {
+			return err
 		}
+		method.media.deliver(changed)
+	case StatusCodeAuthorizationCredentials:
+		credentials := AuthorizationCredentials{}
+		if err := UnmarshalMessage(message, &credentials); err != nil {
+			return err
+		}
+		method.authorization.deliver(credentials)
 	}
-	return scanner.Err()
+	return nil
 }
 
-func (method *Method) handleRequests(ctx context.Context) {
-	// TODO(bruxisma): Add a span here, to at least act as a "root" span.
-	for {
-		select {
-		case request := <-method.requests:
-			writer := NewMessageWriter(method.stream)
-			go func() {
-				// TODO(bruxisma): pass a span or span context into the Handler
-				// AcquireResource call (maybe adjust the signature?).
-				// TODO(bruxisma): media failure means we need to pause all other acquire
-				// resource calls until we are unblocked. We will need to do some work with a
-				// sync.WaitGroup, but have it so that anything that returns a media failure
-				// dynamically becomes the controller, and all other handlers are paused.
-				// TODO(bruxisma): When authorization credentials are needed, a
-				// condition should be used *somehow* to allow us to then signal a
-				// goroutine to resume (and read from) data to allow for the
-				// authorization process to continue.
-				//				_, span := tracer.Start(ctx, "AcquireResource")
-				//				defer span.End()
-				//				setSpanRequest(span, request)
-				err := method.Handler.AcquireResource(writer, request)
-				if err != nil {
-					return
-				}
-				//				span.SetStatus(codes.Error, err.Error())
-				//				span.RecordError(err)
-				message, err := MarshalMessage(err)
-				if err != nil {
-					return
-				}
-				//				_, span = tracer.Start(ctx, "MessageWriter.Write")
-				//				defer span.End()
-				err = writer.Write(message)
-				if err != nil {
-					//					span.RecordError(err)
-					//					span.SetStatus(codes.Error, err.Error())
-				}
-			}()
-		case <-ctx.Done():
-			// TODO(bruxisma): Handle ctx.Err() here
-			return
+// receive scans messages from the input stream in the background, so that
+// callers may wait on them alongside timers and contexts. The messages channel
+// is closed once scanning stops, after which the error channel yields the
+// reason scanning stopped (or nil at the end of input).
+func (method *Method) receive(ctx context.Context, scanner *MessageScanner) (<-chan *Message, <-chan error) {
+	messages := make(chan *Message)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(messages)
+		for scanner.Scan() {
+			message, err := scanner.Message()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case messages <- message:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+		errs <- scanner.Err()
+	}()
+	return messages, errs
+}
+
+// serve runs the Handler, wrapped in the Method's middleware, for a single
+// request, and reports the outcome to APT, unless the Handler already did so
+// itself. An error is reported as a [URIFailure], unless it is a
+// [GeneralFailure].
+func (method *Method) serve(request *Request) {
+	started := time.Now()
+	writer := method.newMessageWriter()
+	writer.request = request
+	method.track(request, writer)
+	defer method.untrack(request)
+	ctx, span := method.tracer.Start(request.Context(), "apt.acquire", trace.WithSpanKind(trace.SpanKindClient))
+	setSpanRequest(span, request)
+	writer.ctx = ctx
+	err := Chain(method.middlewares...)(method.Handler).AcquireResource(writer, request.WithContext(ctx))
+	defer func() {
+		endSpan(span, err)
+		if code := writer.finishedWith(); code != 0 {
+			method.metrics.recordAcquire(request, code, time.Since(started))
+		}
+	}()
+	if writer.isFinished() {
+		return
+	}
+	var message *Message
+	var marshalErr error
+	if err != nil {
+		message, marshalErr = MarshalMessage(newFailureMessage(request, err))
+	} else {
+		done := writer.uriDone()
+		done.URI = requestURI(request)
+		if done.Filename == "" {
+			done.Filename = request.Target
 		}
+		message, marshalErr = MarshalMessage(&done)
+	}
+	if marshalErr != nil {
+		return
+	}
+	// The target is verified when the 201 URI Done is written, in which case
+	// a mismatch is the outcome of the request.
+	if writeErr := writer.Write(message); err == nil && errors.Is(writeErr, &URIFailure{}) {
+		err = writeErr
 	}
 }
 
-func (method *Method) handshake() error {
-	// TODO(bruxisma): Add a span here for the handshake.
-	writer := NewMessageWriter(method.stream)
+// depth returns how many requests may run at once for the request's host.
+func (method *Method) depth(request *Request) int {
+	if !method.capabilities.Pipeline {
+		return 1
+	}
+	if method.pipelineDepth > 0 {
+		return method.pipelineDepth
+	}
+	var scheme, host string
+	if request.Source != nil {
+		scheme, host = request.Source.Scheme, request.Source.Hostname()
+	}
+	depth, err := method.config().ForHost(scheme, host, "Pipeline-Depth").Int(DefaultPipelineDepth)
+	if err != nil {
+		return DefaultPipelineDepth
+	}
+	// APT disables pipelining with a depth of 0.
+	return max(int(depth), 1)
+}
+
+// handshake sends the Method's capabilities to APT, and then waits for APT to
+// reply with its configuration.
+func (method *Method) handshake(ctx context.Context, messages <-chan *Message, errs <-chan error) error {
+	writer := NewMessageWriter(method.output)
 	// We don't bother using a MessageWriter here.
 	message, err := MarshalMessage(&method.capabilities)
 	if err != nil {
 		return err
 	}
-	return writer.Write(message)
-	// TODO(bruxisma): We need to receive the configuration from APT.
+	if err := writer.Write(message); err != nil {
+		return err
+	}
+	timer := time.NewTimer(method.configurationTimeout)
+	defer timer.Stop()
+	select {
+	case message, ok := <-messages:
+		if !ok {
+			if err := <-errs; err != nil {
+				return err
+			}
+			return ErrConfigurationNotReceived
+		}
+		configuration := Configuration{}
+		if err := UnmarshalMessage(message, configuration); err != nil {
+			return err
+		}
+		// The configuration is only published once it is complete, as it may
+		// be read concurrently (see [Method.Configuration]).
+		method.configuration.Store(&configuration)
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w after %s", ErrConfigurationTimeout, method.configurationTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (handler HandlerFunc) AcquireResource(writer *MessageWriter, request *Request) error {
-	// TODO(bruxisma): Fire off a URI Start here.
-	err := handler(writer, request)
-	if err != nil {
-		return err
+	return handler(writer, request)
+}
+
+// newMessageWriter returns a MessageWriter bound to the Method's stream and
+// configuration.
+func (method *Method) newMessageWriter() *MessageWriter {
+	writer := NewMessageWriter(method.output)
+	writer.configuration = method.config()
+	writer.media = method.media
+	writer.authorization = method.authorization
+	writer.aux = method.aux
+	writer.metrics = method.metrics
+	return writer
+}
+
+// newFailureMessage converts an error returned by a Handler into the message
+// reported to APT.
+func newFailureMessage(request *Request, err error) MessageMarshaler {
+	var general GeneralFailure
+	if errors.As(err, &general) {
+		return general
 	}
-	// if writer.IsDone() { send URI Done here }
-	// return URI failure here if we reach this point.
-	return nil
+	failure := &URIFailure{}
+	if errors.As(err, &failure) {
+		if failure.URI == "" {
+			failure.URI = requestURI(request)
+		}
+		return failure
+	}
+	return &URIFailure{URI: requestURI(request), Message: err.Error()}
+}
+
+// requestURI returns the URI APT asked for, even if the request's Source was
+// rewritten since (see [AcquireMux.Rewrite]).
+func requestURI(request *Request) string {
+	if request.uri != "" {
+		return request.uri
+	}
+	if request.Source == nil {
+		return ""
+	}
+	return request.Source.String()
 }
@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// messageRecorder passes every message written to it over a channel.
+type messageRecorder chan string
+
+func (recorder messageRecorder) Write(data []byte) (int, error) {
+	recorder <- string(data)
+	return len(data), nil
+}
+
+// newRecordedMethod returns a Method built with the given options, whose
+// stream has no input and passes every message written to it to the returned
+// recorder.
+func newRecordedMethod(test *testing.T, options ...MethodOption) (*Method, messageRecorder) {
+	test.Helper()
+	recorder := make(messageRecorder, 10)
+	options = append([]MethodOption{WithStream(NewStreamWith(strings.NewReader(""), recorder))}, options...)
+	method, err := NewMethod(context.Background(), "1.0", options...)
+	require.NoError(test, err)
+	return method, recorder
+}
+
+// newTestRequest returns a request for s3://bucket/Release.
+func newTestRequest() *Request {
+	return &Request{Source: &url.URL{Scheme: "s3", Host: "bucket", Path: "/Release"}}
+}
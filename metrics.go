@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// WithMeterProvider sets the provider of the meter used by the [Method]. By
+// default, the global provider (see [otel.SetMeterProvider]) is used.
+//
+// A Method records the following instruments:
+//
+//   - apt.method.acquires: requests handled, by scheme, host and outcome
+//     ("done" or "failed")
+//   - apt.method.acquire.bytes: bytes acquired, as reported by 201 URI Done
+//   - apt.method.acquire.duration: time taken to handle each request
+//   - apt.method.queue.wait: time each request waited to be started
+//   - apt.method.prompts: 351 Aux Request, 402 Authorization Required and
+//     403 Media Failure messages sent, by kind
+//   - apt.method.protocol.errors: failures to talk to APT, by stage
+func WithMeterProvider(provider metric.MeterProvider) MethodOption {
+	return func(method *Method) error {
+		method.meterProvider = provider
+		return nil
+	}
+}
+
+// methodMetrics holds the instruments of a [Method]. A nil *methodMetrics
+// records nothing, so that MessageWriters created outside of a Method need
+// not check for it.
+type methodMetrics struct {
+	acquires       metric.Int64Counter
+	bytes          metric.Int64Counter
+	duration       metric.Float64Histogram
+	queueWait      metric.Float64Histogram
+	prompts        metric.Int64Counter
+	protocolErrors metric.Int64Counter
+}
+
+func newMethodMetrics(provider metric.MeterProvider) (*methodMetrics, error) {
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+	meter := provider.Meter(instrumentationName)
+	metrics := &methodMetrics{}
+	var err error
+	var errs []error
+	metrics.acquires, err = meter.Int64Counter("apt.method.acquires",
+		metric.WithDescription("Requests handled by the method"),
+		metric.WithUnit("{request}"))
+	errs = append(errs, err)
+	metrics.bytes, err = meter.Int64Counter("apt.method.acquire.bytes",
+		metric.WithDescription("Bytes acquired, as reported by URI Done"),
+		metric.WithUnit("By"))
+	errs = append(errs, err)
+	metrics.duration, err = meter.Float64Histogram("apt.method.acquire.duration",
+		metric.WithDescription("Time taken to handle a request"),
+		metric.WithUnit("s"))
+	errs = append(errs, err)
+	metrics.queueWait, err = meter.Float64Histogram("apt.method.queue.wait",
+		metric.WithDescription("Time a request waited to be started"),
+		metric.WithUnit("s"))
+	errs = append(errs, err)
+	metrics.prompts, err = meter.Int64Counter("apt.method.prompts",
+		metric.WithDescription("Aux, authorization and media requests sent to APT"),
+		metric.WithUnit("{message}"))
+	errs = append(errs, err)
+	metrics.protocolErrors, err = meter.Int64Counter("apt.method.protocol.errors",
+		metric.WithDescription("Failures to communicate with APT"),
+		metric.WithUnit("{error}"))
+	errs = append(errs, err)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// recordAcquire records a finished request, given the status code of the
+// message that finished it.
+func (metrics *methodMetrics) recordAcquire(request *Request, code int, duration time.Duration) {
+	if metrics == nil {
+		return
+	}
+	outcome := "done"
+	if code != StatusCodeURIDone {
+		outcome = "failed"
+	}
+	attributes := metric.WithAttributeSet(attribute.NewSet(append(requestAttributes(request), attribute.String("apt.outcome", outcome))...))
+	metrics.acquires.Add(context.Background(), 1, attributes)
+	metrics.duration.Record(context.Background(), duration.Seconds(), attributes)
+}
+
+// recordDone records the size reported by a 201 URI Done message.
+func (metrics *methodMetrics) recordDone(request *Request, message *Message) {
+	if metrics == nil || request == nil {
+		return
+	}
+	size, err := strconv.ParseInt(message.Fields.Get("Size"), 10, 64)
+	if err != nil || size <= 0 {
+		return
+	}
+	metrics.bytes.Add(context.Background(), size, metric.WithAttributes(requestAttributes(request)...))
+}
+
+func (metrics *methodMetrics) recordQueueWait(request *Request, wait time.Duration) {
+	if metrics == nil {
+		return
+	}
+	metrics.queueWait.Record(context.Background(), wait.Seconds(), metric.WithAttributes(requestAttributes(request)...))
+}
+
+// recordPrompt records a message sent to APT that asks for something, where
+// kind is "aux", "authorization" or "media".
+func (metrics *methodMetrics) recordPrompt(kind string) {
+	if metrics == nil {
+		return
+	}
+	metrics.prompts.Add(context.Background(), 1, metric.WithAttributes(attribute.String("apt.prompt", kind)))
+}
+
+// recordProtocolError records a failure to communicate with APT, where stage
+// is "handshake", "receive" or "dispatch".
+func (metrics *methodMetrics) recordProtocolError(stage string, err error) {
+	if metrics == nil || err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrMethodShutdown) {
+		return
+	}
+	metrics.protocolErrors.Add(context.Background(), 1, metric.WithAttributes(attribute.String("apt.stage", stage)))
+}
+
+func requestAttributes(request *Request) []attribute.KeyValue {
+	var scheme, host string
+	if request.Source != nil {
+		scheme, host = request.Source.Scheme, request.Source.Host
+	}
+	return []attribute.KeyValue{
+		attribute.String("apt.scheme", scheme),
+		attribute.String("apt.host", host),
+	}
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type MetricsSuite struct {
+	suite.Suite
+	reader   *sdkmetric.ManualReader
+	provider *sdkmetric.MeterProvider
+}
+
+func (suite *MetricsSuite) SetupTest() {
+	suite.reader = sdkmetric.NewManualReader()
+	suite.provider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(suite.reader))
+}
+
+// collect returns the data points of every instrument, by name.
+func (suite *MetricsSuite) collect() map[string]metricdata.Aggregation {
+	data := metricdata.ResourceMetrics{}
+	suite.Require().NoError(suite.reader.Collect(context.Background(), &data))
+	metrics := map[string]metricdata.Aggregation{}
+	for _, scope := range data.ScopeMetrics {
+		for _, metric := range scope.Metrics {
+			metrics[metric.Name] = metric.Data
+		}
+	}
+	return metrics
+}
+
+// sum returns the value of the counter with the given attribute, or the total
+// of all its values if key is empty.
+func (suite *MetricsSuite) sum(data metricdata.Aggregation, key, value string) int64 {
+	sum, ok := data.(metricdata.Sum[int64])
+	suite.Require().True(ok)
+	total := int64(0)
+	for _, point := range sum.DataPoints {
+		if found, ok := point.Attributes.Value(attribute.Key(key)); key == "" || (ok && found.AsString() == value) {
+			total += point.Value
+		}
+	}
+	return total
+}
+
+func (suite *MetricsSuite) count(data metricdata.Aggregation) uint64 {
+	histogram, ok := data.(metricdata.Histogram[float64])
+	suite.Require().True(ok)
+	total := uint64(0)
+	for _, point := range histogram.DataPoints {
+		total += point.Count
+	}
+	return total
+}
+
+func (suite *MetricsSuite) TestAcquires() {
+	input := heredoc.Doc(`
+    601 Configuration
+    Config-Item: Dir=/
+
+    600 URI Acquire
+    URI: s3://bucket/Release
+    Filename: /tmp/Release
+
+    600 URI Acquire
+    URI: s3://bucket/missing
+    Filename: /tmp/missing
+
+  `)
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(input), &strings.Builder{})),
+		WithMeterProvider(suite.provider),
+		WithHandlerFunction(func(writer *MessageWriter, request *Request) error {
+			if request.Source.Path == "/missing" {
+				return errors.New("no such object")
+			}
+			message, err := MarshalMessage(&URIDone{URI: request.Source.String(), Filename: request.Target, Size: 1024})
+			if err != nil {
+				return err
+			}
+			return writer.Write(message)
+		}))
+	suite.Require().NoError(err)
+	suite.Require().NoError(method.SendAndReceive())
+
+	metrics := suite.collect()
+	suite.Equal(int64(1), suite.sum(metrics["apt.method.acquires"], "apt.outcome", "done"))
+	suite.Equal(int64(1), suite.sum(metrics["apt.method.acquires"], "apt.outcome", "failed"))
+	suite.Equal(int64(2), suite.sum(metrics["apt.method.acquires"], "apt.host", "bucket"))
+	suite.Equal(int64(1024), suite.sum(metrics["apt.method.acquire.bytes"], "", ""))
+	suite.Equal(uint64(2), suite.count(metrics["apt.method.acquire.duration"]))
+	suite.Equal(uint64(2), suite.count(metrics["apt.method.queue.wait"]))
+}
+
+func (suite *MetricsSuite) TestProtocolErrors() {
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader("600 URI Acquire\nURI: s3://bucket/Release\n\n"), &strings.Builder{})),
+		WithMeterProvider(suite.provider))
+	suite.Require().NoError(err)
+	suite.ErrorIs(method.SendAndReceive(), ErrUnexpectedMessage)
+	suite.Equal(int64(1), suite.sum(suite.collect()["apt.method.protocol.errors"], "apt.stage", "handshake"))
+}
+
+func (suite *MetricsSuite) TestPrompts() {
+	method, _ := newRecordedMethod(suite.T(), WithMeterProvider(suite.provider))
+	writer := method.newMessageWriter()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer.RequestCredentials(ctx, "repo.example.com")
+	writer.RequestCredentials(ctx, "mirror.example.com")
+	suite.Equal(int64(2), suite.sum(suite.collect()["apt.method.prompts"], "apt.prompt", "authorization"))
+}
+
+func TestMetrics(test *testing.T) {
+	suite.Run(test, new(MetricsSuite))
+}
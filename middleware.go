@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Middleware wraps a [Handler] to add behaviour around it, in the same style
+// as net/http middleware.
+type Middleware func(Handler) Handler
+
+// Chain combines several middleware into one. The first middleware is the
+// outermost, so that Chain(a, b)(handler) is equivalent to a(b(handler)).
+func Chain(middlewares ...Middleware) Middleware {
+	return func(handler Handler) Handler {
+		for index := len(middlewares) - 1; index >= 0; index-- {
+			handler = middlewares[index](handler)
+		}
+		return handler
+	}
+}
+
+// WithMiddleware wraps the [transport.Method.Handler] with the given
+// middleware, in the order given (see [Chain]). It may be passed more than
+// once, in which case later middleware is nested inside earlier middleware.
+func WithMiddleware(middlewares ...Middleware) MethodOption {
+	return func(method *Method) error {
+		method.middlewares = append(method.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// WithContext returns a shallow copy of the request with its context changed
+// to ctx. The provided ctx must be non-nil.
+func (request *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+	clone := *request
+	clone.ctx = ctx
+	return &clone
+}
+
+// Recover returns a middleware that recovers from a panic in the handler,
+// and returns it as an error wrapping [ErrHandlerPanic] instead, which is then
+// reported to APT as a [URIFailure]. The panic is also sent as a 101 Log
+// message.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(writer *MessageWriter, request *Request) (err error) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					writer.Logf("panic while acquiring %s: %v", requestURI(request), recovered)
+					err = fmt.Errorf("%w: %v", ErrHandlerPanic, recovered)
+				}
+			}()
+			return next.AcquireResource(writer, request)
+		})
+	}
+}
+
+// Logging returns a middleware that sends a 101 Log message when a request
+// starts, and another one with its duration and outcome when it finishes.
+// APT only shows these messages when Debug::pkgAcquire::Worker is set.
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(writer *MessageWriter, request *Request) error {
+			uri := requestURI(request)
+			started := time.Now()
+			writer.Logf("acquiring %s", uri)
+			err := next.AcquireResource(writer, request)
+			if err != nil {
+				writer.Logf("failed to acquire %s after %s: %v", uri, time.Since(started), err)
+			} else {
+				writer.Logf("acquired %s in %s", uri, time.Since(started))
+			}
+			return err
+		})
+	}
+}
+
+// Timeout returns a middleware that cancels the context of the request once
+// the timeout has elapsed. Handlers must watch [Request.Context] for this to
+// have any effect. An error returned after the timeout has elapsed is
+// wrapped with [context.DeadlineExceeded].
+func Timeout(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(writer *MessageWriter, request *Request) error {
+			ctx, cancel := context.WithTimeout(request.Context(), timeout)
+			defer cancel()
+			err := next.AcquireResource(writer, request.WithContext(ctx))
+			if err != nil && ctx.Err() == context.DeadlineExceeded && !errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %s: %w", context.DeadlineExceeded, timeout, err)
+			}
+			return err
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MiddlewareSuite struct {
+	suite.Suite
+}
+
+func (suite *MiddlewareSuite) TestChain() {
+	order := []string{}
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(writer *MessageWriter, request *Request) error {
+				order = append(order, name)
+				return next.AcquireResource(writer, request)
+			})
+		}
+	}
+	handler := Chain(record("a"), record("b"), record("c"))(HandlerFunc(func(*MessageWriter, *Request) error {
+		order = append(order, "handler")
+		return nil
+	}))
+	suite.Require().NoError(handler.AcquireResource(NewMessageWriter(&strings.Builder{}), newTestRequest()))
+	suite.Equal([]string{"a", "b", "c", "handler"}, order)
+}
+
+func (suite *MiddlewareSuite) TestWithMiddleware() {
+	output := strings.Builder{}
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(""), &output)),
+		WithMiddleware(Recover()),
+		WithMiddleware(Logging()),
+		WithHandlerFunction(func(*MessageWriter, *Request) error {
+			panic("out of disc space")
+		}))
+	suite.Require().NoError(err)
+	method.serve(newTestRequest())
+	suite.Contains(output.String(), "101 Log\nMessage: acquiring s3://bucket/Release\n\n")
+	suite.Contains(output.String(), "101 Log\nMessage: panic while acquiring s3://bucket/Release: out of disc space\n")
+	suite.Contains(output.String(), "400 URI Failure\nMessage: handler panicked: out of disc space\nUri: s3://bucket/Release\n\n")
+}
+
+func (suite *MiddlewareSuite) TestTimeout() {
+	handler := Timeout(10 * time.Millisecond)(HandlerFunc(func(writer *MessageWriter, request *Request) error {
+		<-request.Context().Done()
+		return errors.New("connection closed")
+	}))
+	request := newTestRequest()
+	err := handler.AcquireResource(NewMessageWriter(&strings.Builder{}), request)
+	suite.ErrorIs(err, context.DeadlineExceeded)
+	suite.ErrorContains(err, "connection closed")
+	suite.NoError(request.Context().Err())
+}
+
+func TestMiddleware(test *testing.T) {
+	suite.Run(test, new(MiddlewareSuite))
+}
@@ -1,6 +1,12 @@
 package transport
 
-import "net/url"
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+)
 
 // Redirect (status code 103) is currently undocumented by the APT transport
 // method protocol.
@@ -18,9 +24,151 @@ type Redirect struct {
 // The requester will get a 600 URI Acquire with the URI it requested and the
 // filename will either be an existing file if the request was a success or if
 // the acquire failed for the some reason the file will not exist.
+//
+// [transport.AuxRequest.ItemURI] is the URI of the request the auxiliary file
+// is needed for. When empty, [MessageWriter.RequestAux] fills it in with the
+// URI of the handler's request.
 type AuxRequest struct {
+	ItemURI     string `transport:"URI"`
 	MaximumSize int64  `transport:"MaximumSize"`
 	ShortDesc   string `transport:"Aux-ShortDesc"`
 	Description string `transport:"Aux-Description"`
 	URI         string `transport:"Aux-URI"`
 }
+
+func (request *AuxRequest) MarshalMessage() (*Message, error) {
+	fields, err := MarshalFields(request)
+	if err != nil {
+		return nil, err
+	}
+	message := &Message{
+		StatusCode: StatusCodeAuxRequest,
+		Summary:    "Aux Request",
+		Fields:     fields,
+	}
+	return message, nil
+}
+
+// RequestAux asks APT to download an auxiliary file (e.g., a key or index the
+// method needs) through whichever method handles its URI, and waits for it.
+// It returns the local path of the file.
+//
+// APT answers with a 600 URI Acquire for [transport.AuxRequest.URI], which is
+// routed back to the caller instead of the [Method]'s Handler. If APT failed
+// to download the file, an error wrapping [ErrAuxFileMissing] is returned.
+// Handlers asking for the same URI while a request is outstanding share the
+// result.
+//
+// RequestAux returns [ErrAuxRequestsNotAdvertised] immediately unless
+// [transport.Capabilities.AuxRequests] was set.
+func (writer *MessageWriter) RequestAux(ctx context.Context, request AuxRequest) (string, error) {
+	if writer.aux == nil {
+		return "", ErrNoMethod
+	}
+	if request.ItemURI == "" && writer.request != nil {
+		request.ItemURI = requestURI(writer.request)
+	}
+	return writer.aux.request(ctx, writer, &request)
+}
+
+// auxBroker routes the 600 URI Acquire messages APT sends in reply to a 351
+// Aux Request to the handlers waiting for them, by URI.
+type auxBroker struct {
+	enabled   bool
+	mutex     sync.Mutex
+	pending   map[string]*pendingAux
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type pendingAux struct {
+	filename string
+	err      error
+	replied  chan struct{}
+}
+
+func newAuxBroker(enabled bool) *auxBroker {
+	return &auxBroker{
+		enabled: enabled,
+		pending: map[string]*pendingAux{},
+		done:    make(chan struct{}),
+	}
+}
+
+func (broker *auxBroker) request(ctx context.Context, writer *MessageWriter, request *AuxRequest) (string, error) {
+	if !broker.enabled {
+		return "", ErrAuxRequestsNotAdvertised
+	}
+	pending, err := broker.await(writer, request)
+	if err != nil {
+		return "", err
+	}
+	select {
+	case <-pending.replied:
+	case <-broker.done:
+		return "", ErrMethodShutdown
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if pending.err != nil {
+		return "", pending.err
+	}
+	if _, err := os.Stat(pending.filename); err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrAuxFileMissing, request.URI, err)
+	}
+	return pending.filename, nil
+}
+
+// await returns the outstanding request for the auxiliary URI, sending a 351
+// Aux Request if there is none. Like [authorizationBroker.await], the message
+// is written without holding the mutex.
+func (broker *auxBroker) await(writer *MessageWriter, request *AuxRequest) (*pendingAux, error) {
+	broker.mutex.Lock()
+	pending, ok := broker.pending[request.URI]
+	if !ok {
+		pending = &pendingAux{replied: make(chan struct{})}
+		broker.pending[request.URI] = pending
+	}
+	broker.mutex.Unlock()
+	if ok {
+		return pending, nil
+	}
+	message, err := MarshalMessage(request)
+	if err == nil {
+		err = writer.Write(message)
+	}
+	if err != nil {
+		broker.mutex.Lock()
+		defer broker.mutex.Unlock()
+		if broker.pending[request.URI] == pending {
+			delete(broker.pending, request.URI)
+			pending.err = err
+			close(pending.replied)
+		}
+		return nil, err
+	}
+	writer.metrics.recordPrompt("aux")
+	return pending, nil
+}
+
+// deliver hands the filename of a 600 URI Acquire for uri to the handlers waiting
+// for it. It reports whether the message was the reply to an Aux Request, in
+// which case it must not be handled as a new request.
+func (broker *auxBroker) deliver(uri, filename string) bool {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	pending, ok := broker.pending[uri]
+	if !ok {
+		return false
+	}
+	delete(broker.pending, uri)
+	pending.filename = filename
+	close(pending.replied)
+	return true
+}
+
+// close makes every outstanding and future request fail with
+// [ErrMethodShutdown].
+func (broker *auxBroker) close() {
+	broker.closeOnce.Do(func() { close(broker.done) })
+}
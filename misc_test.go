@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AuxRequestSuite struct {
+	suite.Suite
+}
+
+func newAuxReply(uri, filename string) *Message {
+	message := &Message{StatusCode: StatusCodeURIAcquire, Summary: "URI Acquire", Fields: Fields{}}
+	message.Fields.Set("URI", uri)
+	message.Fields.Set("Filename", filename)
+	return message
+}
+
+func (suite *AuxRequestSuite) TestRequestAux() {
+	method, recorder := newRecordedMethod(suite.T(), WithCapabilities(Capabilities{AuxRequests: true}))
+	writer := method.newMessageWriter()
+	writer.request = &Request{Source: &url.URL{Scheme: "s3", Host: "bucket", Path: "/Release"}}
+
+	type result struct {
+		path string
+		err  error
+	}
+	request := func(uri string) <-chan result {
+		results := make(chan result, 1)
+		go func() {
+			path, err := writer.RequestAux(context.Background(), AuxRequest{URI: uri, ShortDesc: "key"})
+			results <- result{path, err}
+		}()
+		return results
+	}
+	pending := request("https://example.com/key.gpg")
+	var message string
+	select {
+	case message = <-recorder:
+	case <-time.After(time.Second):
+		suite.FailNow("no message was sent")
+	}
+	suite.Contains(message, "351 Aux Request\n")
+	suite.Contains(message, "Aux-Uri: https://example.com/key.gpg\n")
+	suite.Contains(message, "Aux-Shortdesc: key\n")
+	suite.Contains(message, "\nUri: s3://bucket/Release\n")
+
+	path := filepath.Join(suite.T().TempDir(), "key.gpg")
+	suite.Require().NoError(os.WriteFile(path, []byte("key"), 0o644))
+	suite.Require().NoError(method.dispatch(context.Background(), context.Background(), newAuxReply("https://example.com/key.gpg", path)))
+	found := <-pending
+	suite.NoError(found.err)
+	suite.Equal(path, found.path)
+	suite.Zero(method.QueueStats().Started)
+	suite.Zero(method.QueueStats().Length)
+
+	pending = request("https://example.com/missing.gpg")
+	<-recorder
+	missing := filepath.Join(suite.T().TempDir(), "missing.gpg")
+	suite.Require().NoError(method.dispatch(context.Background(), context.Background(), newAuxReply("https://example.com/missing.gpg", missing)))
+	suite.ErrorIs((<-pending).err, ErrAuxFileMissing)
+}
+
+func (suite *AuxRequestSuite) TestNotAdvertised() {
+	method, _ := newRecordedMethod(suite.T())
+	_, err := method.newMessageWriter().RequestAux(context.Background(), AuxRequest{URI: "https://example.com/key.gpg"})
+	suite.ErrorIs(err, ErrAuxRequestsNotAdvertised)
+}
+
+func TestAuxRequest(test *testing.T) {
+	suite.Run(test, new(AuxRequestSuite))
+}
@@ -0,0 +1,214 @@
+package transport
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// AcquireMux is a request multiplexer, in the style of [net/http.ServeMux].
+// It matches the URI of each request against a list of registered patterns,
+// and calls the handler of the pattern that most closely matches.
+//
+// Patterns have the form "scheme://host/path". The scheme must always be
+// given, and is matched exactly (ignoring case), so that a Method serving
+// "s3+https" and "oci" can route each scheme to its own handler. The host is
+// optional: an empty host matches any host, a host starting with "*." matches
+// any subdomain, and any other host must match exactly, including its port.
+// A path ending in "/" matches every path below it, while any other path must
+// match exactly. A missing path is the same as "/".
+//
+// When several patterns match, an exact host takes precedence over a
+// subdomain wildcard, which takes precedence over any host. Between patterns
+// with the same host, the longest path wins.
+//
+// Requests matching no pattern are passed to the fallback handler (see
+// [AcquireMux.HandleFallback]). Without one, they fail with [ErrNoHandler].
+type AcquireMux struct {
+	mutex    sync.RWMutex
+	entries  map[string]muxEntry
+	fallback Handler
+	rewrites []func(*url.URL) (*url.URL, error)
+}
+
+type muxEntry struct {
+	scheme  string
+	host    string
+	path    string
+	handler Handler
+}
+
+// NewAcquireMux allocates and returns a new [AcquireMux].
+func NewAcquireMux() *AcquireMux {
+	return &AcquireMux{entries: map[string]muxEntry{}}
+}
+
+// Handle registers the handler for the given pattern. It panics if the
+// pattern is invalid, or a handler was already registered for it.
+func (mux *AcquireMux) Handle(pattern string, handler Handler) {
+	entry, err := parseMuxPattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	if handler == nil {
+		panic("apt/transport: nil handler for pattern " + pattern)
+	}
+	entry.handler = handler
+	key := entry.scheme + "://" + entry.host + entry.path
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	if _, ok := mux.entries[key]; ok {
+		panic("apt/transport: multiple registrations for pattern " + pattern)
+	}
+	mux.entries[key] = entry
+}
+
+// HandleFunc registers the handler function for the given pattern.
+func (mux *AcquireMux) HandleFunc(pattern string, function func(*MessageWriter, *Request) error) {
+	mux.Handle(pattern, HandlerFunc(function))
+}
+
+// HandleFallback registers the handler for requests that match no pattern.
+func (mux *AcquireMux) HandleFallback(handler Handler) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.fallback = handler
+}
+
+// Rewrite registers a function that rewrites the URI of every request before
+// it is matched, e.g. to map a "file+cache" URI onto a local path, or a
+// mirror onto its canonical host. Rewrites run in the order they were
+// registered, and an error fails the request.
+//
+// The handler receives a copy of the request with the rewritten
+// [transport.Request.Source]. Messages sent to APT on behalf of the request
+// (e.g., 201 URI Done) still carry the URI APT asked for.
+func (mux *AcquireMux) Rewrite(rewrite func(*url.URL) (*url.URL, error)) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.rewrites = append(mux.rewrites, rewrite)
+}
+
+// Handler returns the handler to use for the given URI, and the pattern it
+// was registered with. If no pattern matches, the fallback handler (if any)
+// is returned with an empty pattern.
+func (mux *AcquireMux) Handler(uri *url.URL) (Handler, string) {
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+	var best *muxEntry
+	for _, entry := range mux.entries {
+		if !entry.matches(uri) {
+			continue
+		}
+		if best == nil || entry.precedes(best) {
+			best = &entry
+		}
+	}
+	if best == nil {
+		return mux.fallback, ""
+	}
+	return best.handler, best.scheme + "://" + best.host + best.path
+}
+
+// AcquireResource rewrites the request's URI, and then passes the request to
+// the handler whose pattern most closely matches it.
+func (mux *AcquireMux) AcquireResource(writer *MessageWriter, request *Request) error {
+	mux.mutex.RLock()
+	rewrites := mux.rewrites
+	mux.mutex.RUnlock()
+	if request.Source != nil && len(rewrites) != 0 {
+		source := request.Source
+		for _, rewrite := range rewrites {
+			rewritten, err := rewrite(source)
+			if err != nil {
+				return err
+			}
+			source = rewritten
+		}
+		request = request.withSource(source)
+	}
+	var handler Handler
+	if request.Source != nil {
+		handler, _ = mux.Handler(request.Source)
+	} else {
+		mux.mutex.RLock()
+		handler = mux.fallback
+		mux.mutex.RUnlock()
+	}
+	if handler == nil {
+		return fmt.Errorf("%w: %s", ErrNoHandler, requestURI(request))
+	}
+	return handler.AcquireResource(writer, request)
+}
+
+// withSource returns a shallow copy of the request with its Source changed,
+// which still reports the URI APT asked for.
+func (request *Request) withSource(source *url.URL) *Request {
+	clone := *request
+	clone.uri = requestURI(request)
+	clone.Source = source
+	return &clone
+}
+
+func parseMuxPattern(pattern string) (muxEntry, error) {
+	scheme, rest, ok := strings.Cut(pattern, "://")
+	if !ok || scheme == "" {
+		return muxEntry{}, fmt.Errorf("apt/transport: pattern %q has no scheme", pattern)
+	}
+	host, path, found := strings.Cut(rest, "/")
+	path = "/" + path
+	if !found {
+		path = "/"
+	}
+	if strings.Contains(host, "*") && (!strings.HasPrefix(host, "*.") || strings.Count(host, "*") != 1) {
+		return muxEntry{}, fmt.Errorf("apt/transport: pattern %q has an invalid host wildcard", pattern)
+	}
+	return muxEntry{scheme: strings.ToLower(scheme), host: strings.ToLower(host), path: path}, nil
+}
+
+func (entry *muxEntry) matches(uri *url.URL) bool {
+	if !strings.EqualFold(entry.scheme, uri.Scheme) {
+		return false
+	}
+	host := strings.ToLower(uri.Host)
+	switch {
+	case entry.host == "":
+	case strings.HasPrefix(entry.host, "*."):
+		if !strings.HasSuffix(host, entry.host[1:]) {
+			return false
+		}
+	case entry.host != host:
+		return false
+	}
+	path := uri.Path
+	if path == "" {
+		path = "/"
+	}
+	if strings.HasSuffix(entry.path, "/") {
+		return strings.HasPrefix(path, entry.path)
+	}
+	return path == entry.path
+}
+
+// precedes reports whether entry is a closer match than other, when both
+// match the same URI.
+func (entry *muxEntry) precedes(other *muxEntry) bool {
+	if rank, otherRank := entry.hostRank(), other.hostRank(); rank != otherRank {
+		return rank > otherRank
+	}
+	if len(entry.host) != len(other.host) {
+		return len(entry.host) > len(other.host)
+	}
+	return len(entry.path) > len(other.path)
+}
+
+func (entry *muxEntry) hostRank() int {
+	switch {
+	case entry.host == "":
+		return 0
+	case strings.HasPrefix(entry.host, "*."):
+		return 1
+	}
+	return 2
+}
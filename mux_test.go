@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AcquireMuxSuite struct {
+	suite.Suite
+}
+
+// named returns a handler that logs its name along with the URI of each
+// request it handles.
+func named(name string) Handler {
+	return HandlerFunc(func(writer *MessageWriter, request *Request) error {
+		writer.Log(name + " " + request.Source.String())
+		return nil
+	})
+}
+
+func (suite *AcquireMuxSuite) route(mux *AcquireMux, uri string) string {
+	source, err := url.Parse(uri)
+	suite.Require().NoError(err)
+	output := strings.Builder{}
+	if err := mux.AcquireResource(NewMessageWriter(&output), &Request{Source: source}); err != nil {
+		return err.Error()
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(output.String(), "101 Log\nMessage: "), "\n\n")
+}
+
+func (suite *AcquireMuxSuite) TestPatterns() {
+	mux := NewAcquireMux()
+	mux.Handle("s3+https://", named("s3"))
+	mux.Handle("s3+https://*.example.com/", named("wildcard"))
+	mux.Handle("s3+https://bucket.example.com/debian/", named("debian"))
+	mux.Handle("s3+https://bucket.example.com/debian/dists/stable/Release", named("release"))
+	mux.Handle("oci://registry.example.com:5000/", named("oci"))
+
+	suite.Equal("s3 s3+https://other.org/debian/Release", suite.route(mux, "s3+https://other.org/debian/Release"))
+	suite.Equal("wildcard s3+https://mirror.example.com/Release", suite.route(mux, "s3+https://mirror.example.com/Release"))
+	suite.Equal("debian s3+https://bucket.example.com/debian/pool/a.deb", suite.route(mux, "s3+https://bucket.example.com/debian/pool/a.deb"))
+	suite.Equal("wildcard s3+https://bucket.example.com/debian-security/Release", suite.route(mux, "s3+https://bucket.example.com/debian-security/Release"))
+	suite.Equal("release s3+https://bucket.example.com/debian/dists/stable/Release", suite.route(mux, "S3+HTTPS://bucket.example.com/debian/dists/stable/Release"))
+	suite.Equal("oci oci://registry.example.com:5000/library/Release", suite.route(mux, "oci://registry.example.com:5000/library/Release"))
+	suite.Contains(suite.route(mux, "oci://registry.example.com/library/Release"), ErrNoHandler.Error())
+
+	_, pattern := mux.Handler(&url.URL{Scheme: "s3+https", Host: "bucket.example.com", Path: "/debian/Release"})
+	suite.Equal("s3+https://bucket.example.com/debian/", pattern)
+
+	mux.HandleFallback(named("fallback"))
+	suite.Equal("fallback file:///var/cache/Release", suite.route(mux, "file:///var/cache/Release"))
+}
+
+func (suite *AcquireMuxSuite) TestInvalidPatterns() {
+	mux := NewAcquireMux()
+	mux.Handle("oci://registry/", named("oci"))
+	suite.Panics(func() { mux.Handle("oci://registry/", named("again")) })
+	suite.Panics(func() { mux.Handle("/no/scheme/", named("path")) })
+	suite.Panics(func() { mux.Handle("oci://registry.*/", named("wildcard")) })
+	suite.Panics(func() { mux.Handle("oci://other/", nil) })
+}
+
+func (suite *AcquireMuxSuite) TestRewrite() {
+	mux := NewAcquireMux()
+	mux.Rewrite(func(uri *url.URL) (*url.URL, error) {
+		if uri.Scheme != "file+cache" {
+			return uri, nil
+		}
+		rewritten := *uri
+		rewritten.Scheme = "file"
+		return &rewritten, nil
+	})
+	mux.Handle("file://", named("file"))
+	suite.Equal("file file:///var/cache/Release", suite.route(mux, "file+cache:///var/cache/Release"))
+
+	output := strings.Builder{}
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(""), &output)),
+		WithHandler(mux))
+	suite.Require().NoError(err)
+	method.serve(&Request{Source: &url.URL{Scheme: "file+cache", Path: "/var/cache/Release"}, Target: "/tmp/Release"})
+	suite.Contains(output.String(), "101 Log\nMessage: file file:///var/cache/Release\n\n")
+	suite.Contains(output.String(), "Uri: file+cache:///var/cache/Release\n")
+}
+
+func TestAcquireMux(test *testing.T) {
+	suite.Run(test, new(AcquireMuxSuite))
+}
@@ -0,0 +1,194 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval is the minimum time between two 102 Status messages
+// sent by a [Progress].
+const DefaultProgressInterval = time.Second
+
+// Progress reports the progress of a transfer to APT. It is an [io.Writer]
+// that counts the bytes written to it, so it may be used with
+// [io.TeeReader] or [io.MultiWriter], or may wrap the [io.Reader] or
+// [io.Writer] a handler already uses (see [Progress.Reader] and
+// [Progress.Writer]).
+//
+// While bytes are transferred, a 102 Status message with the amount
+// transferred and the transfer rate is sent at most once every Interval. The
+// total size, including the resume point, is used as the Size of the 201 URI
+// Done the [Method] sends when the handler returns.
+type Progress struct {
+	// Interval is the minimum time between two 102 Status messages. It
+	// defaults to [DefaultProgressInterval].
+	Interval time.Duration
+
+	writer      *MessageWriter
+	mutex       sync.Mutex
+	size        int64
+	resumePoint int64
+	transferred int64
+	created     time.Time
+	reported    time.Time
+	started     bool
+}
+
+type progressReader struct {
+	progress *Progress
+	inner    io.Reader
+}
+
+type progressWriter struct {
+	progress *Progress
+	inner    io.Writer
+}
+
+// Progress returns a new [Progress] that reports the transfer of the request
+// the writer was given for.
+func (writer *MessageWriter) Progress() *Progress {
+	now := time.Now()
+	return &Progress{
+		Interval: DefaultProgressInterval,
+		writer:   writer,
+		size:     -1,
+		created:  now,
+		reported: now,
+	}
+}
+
+// Start sends a 200 URI Start for the request, once the size of the resource
+// is known. The size is the total size of the resource, and the resume point
+// is the number of bytes already present in the target file, which are not
+// transferred again. A negative size means the size is not known. Calling
+// Start more than once has no effect.
+func (progress *Progress) Start(size, resumePoint int64) error {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	if progress.started {
+		return nil
+	}
+	progress.started = true
+	progress.size = size
+	progress.resumePoint = resumePoint
+	start := &URIStart{URI: requestURI(progress.request()), Size: size}
+	if resumePoint > 0 {
+		start.ResumePoint = strconv.FormatInt(resumePoint, 10)
+	}
+	message, err := start.MarshalMessage()
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		message.Fields.Del("Size")
+	}
+	progress.update()
+	return progress.writer.Write(message)
+}
+
+// Write counts the bytes transferred, and sends a 102 Status if the Interval
+// has passed since the last one. It never fails.
+func (progress *Progress) Write(data []byte) (int, error) {
+	progress.add(len(data))
+	return len(data), nil
+}
+
+// Reader returns an [io.Reader] that reports the bytes read from the reader.
+func (progress *Progress) Reader(reader io.Reader) io.Reader {
+	return &progressReader{progress, reader}
+}
+
+// Writer returns an [io.Writer] that reports the bytes written to the writer.
+func (progress *Progress) Writer(writer io.Writer) io.Writer {
+	return &progressWriter{progress, writer}
+}
+
+// Transferred returns the number of bytes transferred so far, not including
+// the resume point.
+func (progress *Progress) Transferred() int64 {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	return progress.transferred
+}
+
+func (progress *Progress) add(count int) {
+	if count <= 0 {
+		return
+	}
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.transferred += int64(count)
+	progress.update()
+	now := time.Now()
+	if now.Sub(progress.reported) < progress.Interval {
+		return
+	}
+	progress.reported = now
+	message, err := Status(progress.describe(now)).MarshalMessage()
+	if err != nil {
+		return
+	}
+	// APT shows the status on the item with the same URI.
+	if uri := requestURI(progress.request()); uri != "" {
+		message.Fields.Set("URI", uri)
+	}
+	progress.writer.Write(message)
+}
+
+// update records the size the request has reached in the 201 URI Done.
+func (progress *Progress) update() {
+	size := progress.resumePoint + progress.transferred
+	progress.writer.updateDone(func(done *URIDone) { done.Size = size })
+}
+
+// describe returns the text of a 102 Status, e.g. "1.5 MB of 3.0 MB (50%) at
+// 750.0 kB/s".
+func (progress *Progress) describe(now time.Time) string {
+	var rate int64
+	if elapsed := now.Sub(progress.created).Seconds(); elapsed > 0 {
+		rate = int64(float64(progress.transferred) / elapsed)
+	}
+	current := progress.resumePoint + progress.transferred
+	if progress.size <= 0 {
+		return fmt.Sprintf("%s at %s/s", formatSize(current), formatSize(rate))
+	}
+	percent := min(current*100/progress.size, 100)
+	return fmt.Sprintf("%s of %s (%d%%) at %s/s", formatSize(current), formatSize(progress.size), percent, formatSize(rate))
+}
+
+func (progress *Progress) request() *Request {
+	if progress.writer.request == nil {
+		return &Request{}
+	}
+	return progress.writer.request
+}
+
+func (reader *progressReader) Read(data []byte) (int, error) {
+	count, err := reader.inner.Read(data)
+	reader.progress.add(count)
+	return count, err
+}
+
+func (writer *progressWriter) Write(data []byte) (int, error) {
+	count, err := writer.inner.Write(data)
+	writer.progress.add(count)
+	return count, err
+}
+
+// formatSize formats a number of bytes with decimal units, as APT does.
+func formatSize(size int64) string {
+	if size < 1000 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	for _, unit := range []string{"kB", "MB", "GB", "TB"} {
+		value /= 1000
+		if value < 1000 {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+	}
+	return fmt.Sprintf("%.1f PB", value/1000)
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ProgressSuite struct {
+	suite.Suite
+}
+
+func (suite *ProgressSuite) TestStart() {
+	buffer := strings.Builder{}
+	writer := NewMessageWriter(&buffer)
+	writer.request = newTestRequest()
+	progress := writer.Progress()
+	suite.Require().NoError(progress.Start(2048, 1024))
+	suite.Require().NoError(progress.Start(4096, 0))
+	suite.Equal("200 URI Start\nResume-Point: 1024\nSize: 2048\nUri: s3://bucket/Release\n\n", buffer.String())
+	suite.Equal(int64(1024), writer.uriDone().Size)
+
+	buffer.Reset()
+	suite.Require().NoError(writer.Progress().Start(-1, 0))
+	suite.Equal("200 URI Start\nUri: s3://bucket/Release\n\n", buffer.String())
+}
+
+func (suite *ProgressSuite) TestStatus() {
+	buffer := strings.Builder{}
+	writer := NewMessageWriter(&buffer)
+	writer.request = newTestRequest()
+	progress := writer.Progress()
+	progress.Interval = time.Hour
+	suite.Require().NoError(progress.Start(2000, 0))
+	buffer.Reset()
+
+	_, err := io.Copy(io.Discard, progress.Reader(strings.NewReader(strings.Repeat("x", 500))))
+	suite.Require().NoError(err)
+	suite.Empty(buffer.String())
+
+	progress.Interval = 0
+	var target bytes.Buffer
+	_, err = progress.Writer(&target).Write(bytes.Repeat([]byte("x"), 500))
+	suite.Require().NoError(err)
+	suite.Equal(500, target.Len())
+	suite.Regexp(`^102 Status\nMessage: 1\.0 kB of 2\.0 kB \(50%\) at .+/s\nUri: s3://bucket/Release\n\n$`, buffer.String())
+	suite.Equal(int64(1000), progress.Transferred())
+	suite.Equal(int64(1000), writer.uriDone().Size)
+}
+
+func (suite *ProgressSuite) TestURIDone() {
+	method, recorder := newRecordedMethod(suite.T(),
+		WithHandlerFunction(func(writer *MessageWriter, request *Request) error {
+			progress := writer.Progress()
+			progress.Start(11, 0)
+			_, err := io.Copy(io.Discard, io.TeeReader(strings.NewReader("hello world"), progress))
+			return err
+		}))
+	request := newTestRequest()
+	request.Target = "/tmp/Release"
+	method.serve(request)
+	suite.Contains(<-recorder, "200 URI Start\n")
+	suite.Equal("201 URI Done\nFilename: /tmp/Release\nSize: 11\nUri: s3://bucket/Release\n\n", <-recorder)
+}
+
+func (suite *ProgressSuite) TestFormatSize() {
+	suite.Equal("999 B", formatSize(999))
+	suite.Equal("1.5 kB", formatSize(1500))
+	suite.Equal("2.0 MB", formatSize(2_000_000))
+	suite.Equal("3.2 GB", formatSize(3_200_000_000))
+}
+
+func TestProgress(test *testing.T) {
+	suite.Run(test, new(ProgressSuite))
+}
@@ -0,0 +1,180 @@
+package transport
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy configures the [RateLimit] middleware. Zero values are
+// taken from the configuration sent by APT, looked up with
+// [Configuration.ForHost]:
+//
+//   - Acquire::<scheme>::Rate-Limit, the number of requests per second
+//   - Acquire::<scheme>::Rate-Burst, the number of requests that may be made at
+//     once after a quiet period
+//   - Acquire::<scheme>::Concurrency-Limit, the number of requests that may run
+//     at once
+//
+// A limit that is zero in both the policy and the configuration is not
+// enforced.
+type RateLimitPolicy struct {
+	Rate             float64
+	Burst            int
+	ConcurrencyLimit int
+}
+
+// RateLimit returns a middleware that limits how often, and how many at once,
+// requests are made to each host. Requests are let through at a steady rate
+// using a token bucket per host, and wait while the host already has as many
+// requests running as allowed. While a request waits, a 102 Status message is
+// sent so that the user can see why.
+//
+// The limits of a host are resolved from the policy and the configuration the
+// first time the host is seen.
+func RateLimit(policy RateLimitPolicy) Middleware {
+	limiters := &hostLimiters{policy: policy, hosts: map[string]*hostLimiter{}}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(writer *MessageWriter, request *Request) error {
+			limiter, err := limiters.get(writer.configuration, request)
+			if err != nil {
+				return err
+			}
+			release, err := limiter.acquire(writer, request)
+			if err != nil {
+				return err
+			}
+			defer release()
+			return next.AcquireResource(writer, request)
+		})
+	}
+}
+
+type hostLimiters struct {
+	policy RateLimitPolicy
+	mutex  sync.Mutex
+	hosts  map[string]*hostLimiter
+}
+
+// hostLimiter holds the token bucket and the concurrency slots of one host.
+type hostLimiter struct {
+	host   string
+	rate   float64
+	burst  float64
+	slots  chan struct{}
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (limiters *hostLimiters) get(cfg Configuration, request *Request) (*hostLimiter, error) {
+	var scheme, host string
+	if request.Source != nil {
+		scheme, host = request.Source.Scheme, request.Source.Host
+	}
+	limiters.mutex.Lock()
+	defer limiters.mutex.Unlock()
+	if limiter, ok := limiters.hosts[host]; ok {
+		return limiter, nil
+	}
+	hostname := ""
+	if request.Source != nil {
+		hostname = request.Source.Hostname()
+	}
+	policy := limiters.policy
+	var errs []error
+	if policy.Rate == 0 {
+		rate, err := cfg.ForHost(scheme, hostname, "Rate-Limit").Float(0)
+		policy.Rate, errs = rate, append(errs, err)
+	}
+	if policy.Burst == 0 {
+		burst, err := cfg.ForHost(scheme, hostname, "Rate-Burst").Int(1)
+		policy.Burst, errs = int(burst), append(errs, err)
+	}
+	if policy.ConcurrencyLimit == 0 {
+		limit, err := cfg.ForHost(scheme, hostname, "Concurrency-Limit").Int(0)
+		policy.ConcurrencyLimit, errs = int(limit), append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	limiter := &hostLimiter{
+		host:  host,
+		rate:  policy.Rate,
+		burst: float64(max(policy.Burst, 1)),
+	}
+	limiter.tokens = limiter.burst
+	if policy.ConcurrencyLimit > 0 {
+		limiter.slots = make(chan struct{}, policy.ConcurrencyLimit)
+	}
+	limiters.hosts[host] = limiter
+	return limiter, nil
+}
+
+// acquire waits until the request may be made, and returns a function that
+// must be called once it has finished.
+func (limiter *hostLimiter) acquire(writer *MessageWriter, request *Request) (func(), error) {
+	ctx := request.Context()
+	if limiter.slots != nil {
+		select {
+		case limiter.slots <- struct{}{}:
+		default:
+			writer.Statusf("Waiting for a free connection to %s", limiter.host)
+			select {
+			case limiter.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	release := func() {
+		if limiter.slots != nil {
+			<-limiter.slots
+		}
+	}
+	delay := limiter.reserve()
+	if delay <= 0 {
+		return release, nil
+	}
+	writer.Statusf("Waiting %s for the rate limit of %s", formatRetryDelay(delay), limiter.host)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return release, nil
+	case <-ctx.Done():
+		limiter.cancel()
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// reserve takes a token from the bucket, and returns how long the caller must
+// wait before the token is actually available.
+func (limiter *hostLimiter) reserve() time.Duration {
+	if limiter.rate <= 0 {
+		return 0
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	now := time.Now()
+	if !limiter.last.IsZero() {
+		limiter.tokens = min(limiter.burst, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.rate)
+	}
+	limiter.last = now
+	limiter.tokens--
+	if limiter.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-limiter.tokens / limiter.rate * float64(time.Second))
+}
+
+// cancel returns a token taken by reserve that was never used.
+func (limiter *hostLimiter) cancel() {
+	if limiter.rate <= 0 {
+		return
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.tokens = min(limiter.burst, limiter.tokens+1)
+}
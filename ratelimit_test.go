@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RateLimitSuite struct {
+	suite.Suite
+}
+
+func (suite *RateLimitSuite) TestRate() {
+	output := strings.Builder{}
+	writer := NewMessageWriter(&output)
+	handler := RateLimit(RateLimitPolicy{Rate: 20})(HandlerFunc(func(*MessageWriter, *Request) error { return nil }))
+	started := time.Now()
+	for range 3 {
+		suite.Require().NoError(handler.AcquireResource(writer, newTestRequest()))
+	}
+	suite.GreaterOrEqual(time.Since(started), 90*time.Millisecond)
+	suite.Contains(output.String(), "102 Status\nMessage: Waiting ")
+	suite.Contains(output.String(), "ms for the rate limit of bucket\n\n")
+
+	output.Reset()
+	other := &Request{Source: &url.URL{Scheme: "s3", Host: "other", Path: "/Release"}}
+	suite.Require().NoError(handler.AcquireResource(writer, other))
+	suite.Empty(output.String())
+}
+
+func (suite *RateLimitSuite) TestConcurrencyLimit() {
+	recorder := make(messageRecorder, 10)
+	writer := NewMessageWriter(recorder)
+	writer.configuration = Configuration{"Acquire::s3::Concurrency-Limit": {"1"}}
+	release := make(chan struct{})
+	running := make(chan string, 2)
+	handler := RateLimit(RateLimitPolicy{})(HandlerFunc(func(writer *MessageWriter, request *Request) error {
+		running <- request.Source.Path
+		<-release
+		return nil
+	}))
+	done := make(chan error, 2)
+	go func() { done <- handler.AcquireResource(writer, newTestRequest()) }()
+	suite.Equal("/Release", <-running)
+	go func() {
+		done <- handler.AcquireResource(writer, &Request{Source: &url.URL{Scheme: "s3", Host: "bucket", Path: "/InRelease"}})
+	}()
+	suite.Equal("102 Status\nMessage: Waiting for a free connection to bucket\n\n", <-recorder)
+	select {
+	case path := <-running:
+		suite.FailNowf("request exceeded the concurrency limit", "%s", path)
+	case <-time.After(20 * time.Millisecond):
+	}
+	release <- struct{}{}
+	suite.Equal("/InRelease", <-running)
+	close(release)
+	suite.NoError(<-done)
+	suite.NoError(<-done)
+}
+
+func (suite *RateLimitSuite) TestCancelled() {
+	writer := NewMessageWriter(&strings.Builder{})
+	handler := RateLimit(RateLimitPolicy{Rate: 0.1})(HandlerFunc(func(*MessageWriter, *Request) error { return nil }))
+	suite.Require().NoError(handler.AcquireResource(writer, newTestRequest()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	suite.ErrorIs(handler.AcquireResource(writer, newTestRequest().WithContext(ctx)), context.DeadlineExceeded)
+}
+
+func (suite *RateLimitSuite) TestInvalidConfiguration() {
+	writer := NewMessageWriter(&strings.Builder{})
+	writer.configuration = Configuration{"Acquire::s3::Rate-Limit": {"fast"}}
+	handler := RateLimit(RateLimitPolicy{})(HandlerFunc(func(*MessageWriter, *Request) error { return nil }))
+	err := handler.AcquireResource(writer, newTestRequest())
+	configurationError := &ConfigurationError{}
+	suite.Require().ErrorAs(err, &configurationError)
+	suite.Equal("Acquire::s3::Rate-Limit", configurationError.Key)
+}
+
+func TestRateLimit(test *testing.T) {
+	suite.Run(test, new(RateLimitSuite))
+}
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// DefaultRetries is the number of times a request is retried by [Retry] when
+// Acquire::Retries is not set, matching APT's own default.
+const DefaultRetries = 3
+
+// DefaultRetryDelay is the delay before the first retry made by [Retry]. Each
+// following retry waits twice as long as the one before.
+const DefaultRetryDelay = time.Second
+
+// DefaultMaximumRetryDelay is the longest [Retry] waits between two attempts
+// when Acquire::Retries::Delay::Maximum is not set, matching APT's own
+// default.
+const DefaultMaximumRetryDelay = 30 * time.Second
+
+// RetryPolicy configures the [Retry] middleware. Zero values are taken from
+// the configuration sent by APT, and then from the defaults.
+type RetryPolicy struct {
+	// Retries is the number of times a request is retried after its first
+	// attempt. By default, it is read from Acquire::Retries, looked up with
+	// [Configuration.ForHost]. A negative value turns retries off.
+	Retries int
+	// Delay is the delay before the first retry. By default, it is
+	// [DefaultRetryDelay], or no delay at all when Acquire::Retries::Delay is
+	// false.
+	Delay time.Duration
+	// MaximumDelay caps the delay between two attempts. By default, it is read
+	// from Acquire::Retries::Delay::Maximum.
+	MaximumDelay time.Duration
+	// IsTransient decides whether an error is worth retrying. By default, it
+	// is [IsTransient].
+	IsTransient func(error) bool
+}
+
+// transientError marks the error it wraps as transient.
+type transientError struct {
+	err error
+}
+
+// Transient marks err as transient, so that [IsTransient] reports true for it,
+// and it is retried by [Retry].
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err}
+}
+
+// IsTransient reports whether err is likely to go away if the request is
+// tried again. This is the case for errors marked with [Transient], a
+// [URIFailure] with [transport.URIFailure.Transient] set, network timeouts,
+// refused and reset connections, and connections closed too early.
+func IsTransient(err error) bool {
+	var marked *transientError
+	if errors.As(err, &marked) {
+		return true
+	}
+	var failure *URIFailure
+	if errors.As(err, &failure) && failure.Transient {
+		return true
+	}
+	var network net.Error
+	if errors.As(err, &network) && network.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Retry returns a middleware that tries a request again when its handler
+// returns a transient error, waiting longer after each attempt. Before each
+// retry, a 102 Status message such as "Retrying in 4s (attempt 2/5)" is sent.
+//
+// Errors that are not transient, and errors returned once the handler has
+// already sent a 201 URI Done or 400 URI Failure, are returned at once. When
+// the last attempt fails with a transient error, it is returned as a
+// [URIFailure] with [transport.URIFailure.Transient] set, so that APT knows it
+// may try again later.
+func Retry(policy RetryPolicy) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(writer *MessageWriter, request *Request) error {
+			policy := policy.resolve(writer.configuration, request)
+			attempts := policy.Retries + 1
+			for attempt := 1; ; attempt++ {
+				err := next.AcquireResource(writer, request)
+				if err == nil || writer.isFinished() || !policy.IsTransient(err) {
+					return err
+				}
+				if attempt == attempts {
+					return newTransientFailure(request, err)
+				}
+				delay := policy.backoff(attempt)
+				writer.Statusf("Retrying in %s (attempt %d/%d)", formatRetryDelay(delay), attempt+1, attempts)
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-request.Context().Done():
+					timer.Stop()
+					return err
+				}
+			}
+		})
+	}
+}
+
+// resolve fills in the unset fields of the policy from the configuration.
+func (policy RetryPolicy) resolve(cfg Configuration, request *Request) RetryPolicy {
+	var scheme, host string
+	if request.Source != nil {
+		scheme, host = request.Source.Scheme, request.Source.Hostname()
+	}
+	if policy.Retries < 0 {
+		policy.Retries = 0
+	} else if policy.Retries == 0 {
+		retries, err := cfg.ForHost(scheme, host, "Retries").Int(DefaultRetries)
+		if err != nil {
+			retries = DefaultRetries
+		}
+		policy.Retries = max(int(retries), 0)
+	}
+	if policy.Delay == 0 {
+		policy.Delay = DefaultRetryDelay
+		if enabled, err := cfg.ForHost(scheme, host, "Retries::Delay").Bool(true); err == nil && !enabled {
+			policy.Delay = -1
+		}
+	}
+	if policy.MaximumDelay == 0 {
+		maximum, err := cfg.ForHost(scheme, host, "Retries::Delay::Maximum").Duration(DefaultMaximumRetryDelay)
+		if err != nil {
+			maximum = DefaultMaximumRetryDelay
+		}
+		policy.MaximumDelay = maximum
+	}
+	if policy.IsTransient == nil {
+		policy.IsTransient = IsTransient
+	}
+	return policy
+}
+
+// backoff returns how long to wait after the given attempt failed. The delay
+// doubles with each attempt, and is then jittered to between half and all of
+// that, so that many requests failing at once do not retry in lockstep.
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	if policy.Delay < 0 {
+		return 0
+	}
+	delay := policy.Delay << min(attempt-1, 30)
+	if delay <= 0 || delay > policy.MaximumDelay {
+		delay = policy.MaximumDelay
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+func formatRetryDelay(delay time.Duration) string {
+	if delay >= time.Second {
+		return delay.Round(time.Second).String()
+	}
+	return delay.Round(time.Millisecond).String()
+}
+
+func newTransientFailure(request *Request, err error) *URIFailure {
+	failure := &URIFailure{}
+	if errors.As(err, &failure) {
+		clone := *failure
+		if clone.URI == "" {
+			clone.URI = requestURI(request)
+		}
+		clone.Transient = true
+		return &clone
+	}
+	return &URIFailure{URI: requestURI(request), Message: err.Error(), Transient: true}
+}
+
+func (err *transientError) Error() string {
+	return err.err.Error()
+}
+
+func (err *transientError) Unwrap() error {
+	return err.err
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RetrySuite struct {
+	suite.Suite
+}
+
+// flaky returns a handler that fails with err the given number of times
+// before succeeding, and counts how often it was called.
+func flaky(failures int, err error, calls *int) Handler {
+	return HandlerFunc(func(*MessageWriter, *Request) error {
+		*calls++
+		if *calls <= failures {
+			return err
+		}
+		return nil
+	})
+}
+
+func (suite *RetrySuite) TestIsTransient() {
+	suite.True(IsTransient(Transient(errors.New("busy"))))
+	suite.True(IsTransient(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)))
+	suite.True(IsTransient(&URIFailure{Message: "503", Transient: true}))
+	suite.False(IsTransient(&URIFailure{Message: "404"}))
+	suite.False(IsTransient(errors.New("no such object")))
+	suite.Nil(Transient(nil))
+}
+
+func (suite *RetrySuite) TestRetrySucceeds() {
+	output := strings.Builder{}
+	writer := NewMessageWriter(&output)
+	calls := 0
+	handler := Retry(RetryPolicy{Delay: time.Millisecond})(flaky(2, Transient(errors.New("busy")), &calls))
+	suite.NoError(handler.AcquireResource(writer, newTestRequest()))
+	suite.Equal(3, calls)
+	suite.Regexp(`^102 Status\nMessage: Retrying in [12]ms \(attempt 2/4\)\n\n102 Status\nMessage: Retrying in [12]ms \(attempt 3/4\)\n\n$`, output.String())
+}
+
+func (suite *RetrySuite) TestRetryConfiguration() {
+	writer := NewMessageWriter(&strings.Builder{})
+	writer.configuration = Configuration{
+		"Acquire::Retries":                 {"5"},
+		"Acquire::s3::Retries":             {"1"},
+		"Acquire::Retries::Delay":          {"false"},
+		"Acquire::s3::Retries::Delay":      {"true"},
+		"Acquire::Retries::Delay::Maximum": {"2"},
+	}
+	policy := RetryPolicy{}.resolve(writer.configuration, newTestRequest())
+	suite.Equal(1, policy.Retries)
+	suite.Equal(DefaultRetryDelay, policy.Delay)
+	suite.Equal(2*time.Second, policy.MaximumDelay)
+	for attempt := 1; attempt < 5; attempt++ {
+		delay := policy.backoff(attempt)
+		suite.LessOrEqual(delay, 2*time.Second)
+		suite.GreaterOrEqual(delay, min(DefaultRetryDelay<<(attempt-1), 2*time.Second)/2)
+	}
+
+	policy = RetryPolicy{}.resolve(writer.configuration, &Request{Source: &url.URL{Scheme: "oci", Host: "registry"}})
+	suite.Equal(5, policy.Retries)
+	suite.Zero(policy.backoff(3))
+}
+
+func (suite *RetrySuite) TestRetryGivesUp() {
+	output := strings.Builder{}
+	writer := NewMessageWriter(&output)
+	calls := 0
+	handler := Retry(RetryPolicy{Retries: 2, Delay: time.Microsecond})(flaky(10, fmt.Errorf("read: %w", syscall.ECONNRESET), &calls))
+	err := handler.AcquireResource(writer, newTestRequest())
+	suite.Equal(3, calls)
+	failure := &URIFailure{}
+	suite.Require().ErrorAs(err, &failure)
+	suite.True(failure.Transient)
+	suite.Equal("s3://bucket/Release", failure.URI)
+	message, err := MarshalMessage(failure)
+	suite.Require().NoError(err)
+	suite.Equal("true", message.Fields.Get("Transient-Failure"))
+
+	calls = 0
+	permanent := errors.New("no such object")
+	suite.ErrorIs(Retry(RetryPolicy{Retries: 2})(flaky(10, permanent, &calls)).AcquireResource(writer, newTestRequest()), permanent)
+	suite.Equal(1, calls)
+}
+
+func (suite *RetrySuite) TestRetryDisabled() {
+	output := strings.Builder{}
+	writer := NewMessageWriter(&output)
+	writer.configuration = Configuration{"Acquire::Retries": {"5"}}
+	calls := 0
+	err := Retry(RetryPolicy{Retries: -1})(flaky(10, Transient(errors.New("busy")), &calls)).AcquireResource(writer, newTestRequest())
+	suite.Equal(1, calls)
+	suite.Empty(output.String())
+	failure := &URIFailure{}
+	suite.Require().ErrorAs(err, &failure)
+	suite.True(failure.Transient)
+}
+
+func TestRetry(test *testing.T) {
+	suite.Run(test, new(RetrySuite))
+}
@@ -44,6 +44,25 @@ func (suite *ScannerSuite) TestScanMessages() {
 	suite.Require().Truef(endsWith, "scanner.Text() did not end with %q", "Send-Config: true")
 }
 
+func (suite *ScannerSuite) TestHeaderOnlyMessages() {
+	scanner := NewMessageScanner(strings.NewReader("601 Configuration\n\n603 Media Changed\n\n"))
+	for _, expected := range []*Message{
+		{StatusCode: StatusCodeConfiguration, Summary: "Configuration", Fields: Fields{}},
+		{StatusCode: StatusCodeMediaChanged, Summary: "Media Changed", Fields: Fields{}},
+	} {
+		suite.Require().True(scanner.Scan())
+		message, err := scanner.Message()
+		suite.Require().NoError(err)
+		suite.Equal(expected, message)
+	}
+	suite.False(scanner.Scan())
+	suite.NoError(scanner.Err())
+}
+
+func (suite *ScannerSuite) TestHeaderNotFound() {
+	suite.ErrorIs((&Message{}).UnmarshalBinary([]byte("\n")), ErrMessageHeaderNotFound)
+}
+
 func FuzzScanMessages(fuzz *testing.F) {
 	capabilities, err := testdata.ReadFile("testdata/0001.capabilities.pass")
 	if err != nil {
@@ -0,0 +1,260 @@
+package transport
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultPipelineDepth is the number of requests for a single host that a
+// pipelining [Method] will run at once, when neither [WithPipelineDepth] nor
+// Acquire::<scheme>::Pipeline-Depth is set. It matches the default APT uses
+// for its http method.
+const DefaultPipelineDepth = 10
+
+// DefaultConcurrencyLimit is the number of requests a [Method] will run at
+// once across all hosts, unless changed with [WithConcurrencyLimit].
+const DefaultConcurrencyLimit = 16
+
+// DefaultQueueDepth is the number of requests a [Method] will hold while they
+// wait to be started, unless changed with [WithQueueDepth].
+const DefaultQueueDepth = 64
+
+// QueueStats is a snapshot of the request queue of a [Method], as returned by
+// [Method.QueueStats].
+type QueueStats struct {
+	Length    int           // Requests waiting to be started
+	Capacity  int           // Requests that may wait before reading stops
+	Running   int           // Requests whose handler is running
+	Started   uint64        // Requests that have left the queue
+	Blocked   uint64        // Times reading stopped because the queue was full
+	TotalWait time.Duration // Time spent in the queue by all started requests
+	MaxWait   time.Duration // Longest time spent in the queue by a request
+}
+
+// AverageWait returns the mean time a started request spent in the queue.
+func (stats QueueStats) AverageWait() time.Duration {
+	if stats.Started == 0 {
+		return 0
+	}
+	return stats.TotalWait / time.Duration(stats.Started)
+}
+
+// scheduler decides when each request is handed to the [Method]'s handler.
+//
+// Requests are queued per host (the host and port of the request's URI).
+// A host may have at most depth(request) requests running at once, and at
+// most limit requests run at once overall. Any request beyond either limit
+// waits in its host's queue.
+//
+// Requests for the same host are started in the order they were submitted,
+// but may finish in any order. Hosts take turns starting requests, so that
+// one busy host cannot starve the others.
+//
+// At most capacity requests may wait to be started. Once the queue is full,
+// submit blocks until a request is started, which in turn stops the [Method]
+// from reading its input.
+type scheduler struct {
+	mutex   sync.Mutex
+	group   sync.WaitGroup
+	slots   chan struct{}
+	closed  chan struct{}
+	pending map[string][]queuedRequest
+	hosts   []string
+	active  map[string]int
+	depths  map[string]int
+	running int
+	paused  int
+	limit   int
+	stats   QueueStats
+	depth   func(*Request) int
+	serve   func(*Request)
+	waited  func(*Request, time.Duration)
+}
+
+type queuedRequest struct {
+	request *Request
+	queued  time.Time
+}
+
+func newScheduler(limit, capacity int, depth func(*Request) int, serve func(*Request)) *scheduler {
+	capacity = max(capacity, 1)
+	return &scheduler{
+		slots:   make(chan struct{}, capacity),
+		closed:  make(chan struct{}),
+		pending: map[string][]queuedRequest{},
+		active:  map[string]int{},
+		depths:  map[string]int{},
+		limit:   max(limit, 1),
+		stats:   QueueStats{Capacity: capacity},
+		depth:   depth,
+		serve:   serve,
+	}
+}
+
+// submit queues the request, and starts it immediately if the limits allow.
+// If the queue is full, submit blocks until there is room for the request, or
+// the context is done. Once the scheduler is closed, submit returns
+// [ErrMethodShutdown].
+func (scheduler *scheduler) submit(ctx context.Context, request *Request) error {
+	select {
+	case <-scheduler.closed:
+		return ErrMethodShutdown
+	case scheduler.slots <- struct{}{}:
+	default:
+		scheduler.mutex.Lock()
+		scheduler.stats.Blocked++
+		scheduler.mutex.Unlock()
+		select {
+		case scheduler.slots <- struct{}{}:
+		case <-scheduler.closed:
+			return ErrMethodShutdown
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	host := requestHost(request)
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	if scheduler.isClosed() {
+		<-scheduler.slots
+		return ErrMethodShutdown
+	}
+	if _, ok := scheduler.depths[host]; !ok {
+		scheduler.depths[host] = max(scheduler.depth(request), 1)
+	}
+	if len(scheduler.pending[host]) == 0 {
+		scheduler.hosts = append(scheduler.hosts, host)
+	}
+	scheduler.pending[host] = append(scheduler.pending[host], queuedRequest{request, time.Now()})
+	scheduler.stats.Length++
+	scheduler.schedule()
+	return nil
+}
+
+// snapshot returns the current statistics of the queue.
+func (scheduler *scheduler) snapshot() QueueStats {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	stats := scheduler.stats
+	stats.Running = scheduler.running
+	return stats
+}
+
+// wait blocks until every started request has finished.
+func (scheduler *scheduler) wait() {
+	scheduler.group.Wait()
+}
+
+// close stops the scheduler from accepting or starting any more requests.
+// The requests that were still waiting to be started are removed from the
+// queue and returned, in the order they were submitted per host.
+func (scheduler *scheduler) close() []*Request {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	if scheduler.isClosed() {
+		return nil
+	}
+	close(scheduler.closed)
+	requests := []*Request{}
+	for _, host := range scheduler.hosts {
+		for _, queued := range scheduler.pending[host] {
+			<-scheduler.slots
+			scheduler.stats.Length--
+			requests = append(requests, queued.request)
+		}
+	}
+	scheduler.hosts = nil
+	clear(scheduler.pending)
+	return requests
+}
+
+func (scheduler *scheduler) isClosed() bool {
+	select {
+	case <-scheduler.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// pause stops the scheduler from starting requests until resume is called.
+func (scheduler *scheduler) pause() {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	scheduler.paused++
+}
+
+// resume undoes a call to pause, and starts any requests that were held back.
+func (scheduler *scheduler) resume() {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	scheduler.paused--
+	scheduler.schedule()
+}
+
+// schedule starts as many pending requests as the limits allow. The mutex
+// must be held by the caller.
+func (scheduler *scheduler) schedule() {
+	for scheduler.running < scheduler.limit && scheduler.paused == 0 && !scheduler.isClosed() {
+		index := slices.IndexFunc(scheduler.hosts, func(host string) bool {
+			return scheduler.active[host] < scheduler.depths[host]
+		})
+		if index < 0 {
+			return
+		}
+		host := scheduler.hosts[index]
+		queued := scheduler.pending[host][0]
+		scheduler.pending[host] = scheduler.pending[host][1:]
+		scheduler.release(queued)
+		// The host goes to the back of the line, so that every host gets a turn.
+		scheduler.hosts = slices.Delete(scheduler.hosts, index, index+1)
+		if len(scheduler.pending[host]) != 0 {
+			scheduler.hosts = append(scheduler.hosts, host)
+		} else {
+			delete(scheduler.pending, host)
+		}
+		scheduler.active[host]++
+		scheduler.running++
+		scheduler.group.Add(1)
+		go scheduler.run(host, queued.request)
+	}
+}
+
+// release frees the queue slot of a request that is about to start, and
+// records how long it waited. The mutex must be held by the caller.
+func (scheduler *scheduler) release(queued queuedRequest) {
+	<-scheduler.slots
+	wait := time.Since(queued.queued)
+	scheduler.stats.Length--
+	scheduler.stats.Started++
+	scheduler.stats.TotalWait += wait
+	scheduler.stats.MaxWait = max(scheduler.stats.MaxWait, wait)
+	if scheduler.waited != nil {
+		scheduler.waited(queued.request, wait)
+	}
+}
+
+func (scheduler *scheduler) run(host string, request *Request) {
+	defer scheduler.group.Done()
+	defer scheduler.finish(host)
+	scheduler.serve(request)
+}
+
+func (scheduler *scheduler) finish(host string) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	scheduler.running--
+	if scheduler.active[host]--; scheduler.active[host] == 0 {
+		delete(scheduler.active, host)
+	}
+	scheduler.schedule()
+}
+
+func requestHost(request *Request) string {
+	if request.Source == nil {
+		return ""
+	}
+	return request.Source.Host
+}
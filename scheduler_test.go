@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SchedulerSuite struct {
+	suite.Suite
+}
+
+// blockingServer records the requests it is given, and blocks each one until
+// it is released.
+type blockingServer struct {
+	release chan struct{}
+	running chan string
+}
+
+func newBlockingServer() *blockingServer {
+	return &blockingServer{
+		release: make(chan struct{}),
+		running: make(chan string, 100),
+	}
+}
+
+func (server *blockingServer) serve(request *Request) {
+	server.running <- request.Source.String()
+	<-server.release
+}
+
+func (server *blockingServer) expect(suite *SchedulerSuite, count int) []string {
+	started := []string{}
+	for range count {
+		select {
+		case uri := <-server.running:
+			started = append(started, uri)
+		case <-time.After(time.Second):
+			suite.FailNow("request was not started")
+		}
+	}
+	select {
+	case uri := <-server.running:
+		suite.FailNowf("request started beyond the limit", "%s", uri)
+	case <-time.After(20 * time.Millisecond):
+	}
+	return started
+}
+
+func newSchedulerRequest(uri string) *Request {
+	source, _ := url.Parse(uri)
+	return &Request{Source: source}
+}
+
+func (suite *SchedulerSuite) submit(scheduler *scheduler, request *Request) {
+	suite.Require().NoError(scheduler.submit(context.Background(), request))
+}
+
+func (suite *SchedulerSuite) TestPipelineDepth() {
+	server := newBlockingServer()
+	scheduler := newScheduler(10, 10, func(*Request) int { return 2 }, server.serve)
+	for _, path := range []string{"a", "b", "c", "d"} {
+		suite.submit(scheduler, newSchedulerRequest("s3://one/"+path))
+	}
+	suite.ElementsMatch([]string{"s3://one/a", "s3://one/b"}, server.expect(suite, 2))
+	server.release <- struct{}{}
+	suite.Equal([]string{"s3://one/c"}, server.expect(suite, 1))
+	close(server.release)
+	server.expect(suite, 1)
+	scheduler.wait()
+}
+
+func (suite *SchedulerSuite) TestConcurrencyLimit() {
+	server := newBlockingServer()
+	scheduler := newScheduler(2, 10, func(*Request) int { return 10 }, server.serve)
+	suite.submit(scheduler, newSchedulerRequest("s3://one/a"))
+	suite.submit(scheduler, newSchedulerRequest("s3://one/b"))
+	suite.submit(scheduler, newSchedulerRequest("s3://two/a"))
+	server.expect(suite, 2)
+	server.release <- struct{}{}
+	suite.Equal([]string{"s3://two/a"}, server.expect(suite, 1))
+	close(server.release)
+	scheduler.wait()
+}
+
+func (suite *SchedulerSuite) TestHostsTakeTurns() {
+	server := newBlockingServer()
+	scheduler := newScheduler(1, 10, func(*Request) int { return 10 }, server.serve)
+	suite.submit(scheduler, newSchedulerRequest("s3://one/a"))
+	suite.submit(scheduler, newSchedulerRequest("s3://one/b"))
+	suite.submit(scheduler, newSchedulerRequest("s3://one/c"))
+	suite.submit(scheduler, newSchedulerRequest("s3://two/a"))
+	order := server.expect(suite, 1)
+	for range 3 {
+		server.release <- struct{}{}
+		order = append(order, server.expect(suite, 1)...)
+	}
+	close(server.release)
+	scheduler.wait()
+	suite.Equal([]string{"s3://one/a", "s3://one/b", "s3://two/a", "s3://one/c"}, order)
+}
+
+func (suite *SchedulerSuite) TestQueueDepth() {
+	server := newBlockingServer()
+	scheduler := newScheduler(1, 2, func(*Request) int { return 1 }, server.serve)
+	suite.submit(scheduler, newSchedulerRequest("s3://one/a"))
+	server.expect(suite, 1)
+	suite.submit(scheduler, newSchedulerRequest("s3://one/b"))
+	suite.submit(scheduler, newSchedulerRequest("s3://one/c"))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	suite.ErrorIs(scheduler.submit(ctx, newSchedulerRequest("s3://one/d")), context.DeadlineExceeded)
+	stats := scheduler.snapshot()
+	suite.Equal(2, stats.Length)
+	suite.Equal(2, stats.Capacity)
+	suite.Equal(1, stats.Running)
+	suite.Equal(uint64(1), stats.Blocked)
+
+	submitted := make(chan error)
+	go func() {
+		submitted <- scheduler.submit(context.Background(), newSchedulerRequest("s3://one/d"))
+	}()
+	select {
+	case <-submitted:
+		suite.FailNow("submit did not block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	server.release <- struct{}{}
+	suite.NoError(<-submitted)
+	close(server.release)
+	scheduler.wait()
+	stats = scheduler.snapshot()
+	suite.Equal(0, stats.Length)
+	suite.Equal(uint64(4), stats.Started)
+	suite.Equal(uint64(2), stats.Blocked)
+	suite.Positive(stats.MaxWait)
+	suite.LessOrEqual(stats.AverageWait(), stats.MaxWait)
+}
+
+func (suite *SchedulerSuite) TestMethodDepth() {
+	method, err := NewMethod(context.Background(), "1.0", WithCapabilities(Capabilities{Pipeline: true}))
+	suite.Require().NoError(err)
+	method.configuration.Store(&Configuration{
+		"Acquire::s3::Pipeline-Depth":                   {"4"},
+		"Acquire::s3::slow.example.com::Pipeline-Depth": {"0"},
+	})
+	suite.Equal(4, method.depth(newSchedulerRequest("s3://bucket/Release")))
+	suite.Equal(1, method.depth(newSchedulerRequest("s3://slow.example.com/Release")))
+	suite.Equal(DefaultPipelineDepth, method.depth(newSchedulerRequest("oci://registry/Release")))
+
+	method, err = NewMethod(context.Background(), "1.0")
+	suite.Require().NoError(err)
+	suite.Equal(1, method.depth(newSchedulerRequest("s3://bucket/Release")))
+}
+
+func (suite *SchedulerSuite) TestServeReportsOutcome() {
+	output := strings.Builder{}
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(""), &output)),
+		WithHandlerFunction(func(writer *MessageWriter, request *Request) error {
+			if request.Source.Path == "/missing" {
+				return errors.New("no such object")
+			}
+			return nil
+		}))
+	suite.Require().NoError(err)
+	method.serve(&Request{Source: &url.URL{Scheme: "s3", Host: "bucket", Path: "/Release"}, Target: "/tmp/Release"})
+	suite.Contains(output.String(), "201 URI Done\nFilename: /tmp/Release\nSize: 0\nUri: s3://bucket/Release\n\n")
+	output.Reset()
+	method.serve(&Request{Source: &url.URL{Scheme: "s3", Host: "bucket", Path: "/missing"}})
+	suite.Contains(output.String(), "400 URI Failure\nMessage: no such object\nUri: s3://bucket/missing\n\n")
+}
+
+func TestScheduler(test *testing.T) {
+	suite.Run(test, new(SchedulerSuite))
+}
@@ -0,0 +1,163 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long a [Method] gives running handlers to
+// finish once its input is closed, its context is cancelled, or it receives
+// one of its shutdown signals, unless changed with [WithShutdownTimeout].
+const DefaultShutdownTimeout = 10 * time.Second
+
+// WithShutdownTimeout sets the grace period given to running handlers when the
+// [Method] shuts down on its own (see [Method.SendAndReceive]). Calls to
+// [Method.Shutdown] use the deadline of the context given instead.
+func WithShutdownTimeout(timeout time.Duration) MethodOption {
+	return func(method *Method) error {
+		method.shutdownTimeout = timeout
+		return nil
+	}
+}
+
+// WithShutdownSignals makes the [Method] shut down gracefully when any of the
+// given signals (typically [os.Interrupt] and [syscall.SIGTERM]) is received
+// while [Method.SendAndReceive] is running.
+func WithShutdownSignals(signals ...os.Signal) MethodOption {
+	return func(method *Method) error {
+		method.shutdownSignals = append(method.shutdownSignals, signals...)
+		return nil
+	}
+}
+
+// WithCleanup registers a function that is called once the [Method] has shut
+// down, and every handler has finished or been abandoned. Registering a
+// cleanup function sets [transport.Capabilities.NeedsCleanup], so that APT
+// closes the Method's input and waits for it to exit, rather than killing it.
+//
+// Cleanup functions are called in the order they were registered.
+func WithCleanup(cleanup func() error) MethodOption {
+	return func(method *Method) error {
+		method.cleanups = append(method.cleanups, cleanup)
+		return nil
+	}
+}
+
+// Shutdown gracefully shuts down the Method, much like
+// [net/http.Server.Shutdown]. Shutdown works by first no longer accepting
+// URI Acquire messages, and sending a [URIFailure] for every request that had
+// not yet started. It then waits for running handlers to finish.
+//
+// If the context expires before all handlers have finished, the context of
+// every remaining [Request] is cancelled, a [URIFailure] is sent for each of
+// them, and an error wrapping [ErrRequestsAbandoned] is returned. Any later
+// writes made by an abandoned handler fail with [ErrMethodShutdown].
+//
+// Finally, the functions registered with [WithCleanup] are called.
+// [Method.SendAndReceive] returns [ErrMethodShutdown] once this has finished.
+//
+// Calling Shutdown more than once waits for the first call to finish and
+// returns the same result.
+func (method *Method) Shutdown(ctx context.Context) error {
+	method.closeOnce.Do(func() { close(method.closing) })
+	return method.stop(ctx, false)
+}
+
+// stop runs the shutdown sequence exactly once. When finishQueued is set,
+// requests that have not yet started are still run, as long as the context
+// allows.
+func (method *Method) stop(ctx context.Context, finishQueued bool) error {
+	method.stopOnce.Do(func() {
+		defer close(method.stopped)
+		method.stopErr = method.drain(ctx, finishQueued)
+	})
+	<-method.stopped
+	return method.stopErr
+}
+
+// stopWithTimeout runs the shutdown sequence with the grace period set by
+// [WithShutdownTimeout].
+func (method *Method) stopWithTimeout(finishQueued bool) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(method.ctx), method.shutdownTimeout)
+	defer cancel()
+	return method.stop(ctx, finishQueued)
+}
+
+func (method *Method) drain(ctx context.Context, finishQueued bool) error {
+	// APT will not answer a 351 Aux Request, 402 Authorization Required or
+	// 403 Media Failure any longer.
+	method.media.close()
+	method.authorization.close()
+	method.aux.close()
+	if !finishQueued {
+		method.failQueued()
+	}
+	finished := make(chan struct{})
+	go func() {
+		method.scheduler.wait()
+		close(finished)
+	}()
+	var err error
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		method.failQueued()
+		if abandoned := method.abandon(); abandoned != 0 {
+			err = fmt.Errorf("%w: %d request(s) did not finish: %w", ErrRequestsAbandoned, abandoned, ctx.Err())
+		}
+	}
+	method.cancelRequests()
+	for _, cleanup := range method.cleanups {
+		err = errors.Join(err, cleanup())
+	}
+	return err
+}
+
+// failQueued stops the scheduler, and reports every request that has not
+// yet started as a [URIFailure].
+func (method *Method) failQueued() {
+	for _, request := range method.scheduler.close() {
+		failure := &URIFailure{URI: requestURI(request), Message: "transport method is shutting down"}
+		if message, err := MarshalMessage(failure); err == nil {
+			method.newMessageWriter().Write(message)
+		}
+	}
+}
+
+// abandon cancels every running request, and reports each one that has not
+// finished as a [URIFailure]. It returns the number of requests abandoned.
+func (method *Method) abandon() int {
+	method.cancelRequests()
+	method.inflightMutex.Lock()
+	defer method.inflightMutex.Unlock()
+	abandoned := 0
+	for request, writer := range method.inflight {
+		failure := &URIFailure{
+			URI:     requestURI(request),
+			Message: "transport method was shut down before the request finished",
+		}
+		message, err := MarshalMessage(failure)
+		if err != nil {
+			continue
+		}
+		if writer.abandon(message) {
+			abandoned++
+		}
+	}
+	return abandoned
+}
+
+func (method *Method) track(request *Request, writer *MessageWriter) {
+	method.inflightMutex.Lock()
+	defer method.inflightMutex.Unlock()
+	method.inflight[request] = writer
+}
+
+func (method *Method) untrack(request *Request) {
+	method.inflightMutex.Lock()
+	defer method.inflightMutex.Unlock()
+	delete(method.inflight, request)
+}
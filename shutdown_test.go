@@ -0,0 +1,136 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type ShutdownSuite struct {
+	suite.Suite
+}
+
+const shutdownInput = `601 Configuration
+Config-Item: Acquire::s3::Timeout=30
+
+600 URI Acquire
+URI: s3://bucket/Release
+Filename: /tmp/Release
+
+600 URI Acquire
+URI: s3://bucket/InRelease
+Filename: /tmp/InRelease
+
+`
+
+func (suite *ShutdownSuite) TestDrainOnEndOfInput() {
+	output := strings.Builder{}
+	cleaned := false
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(shutdownInput), &output)),
+		WithCleanup(func() error {
+			cleaned = true
+			return nil
+		}),
+		WithHandlerFunction(func(writer *MessageWriter, request *Request) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}))
+	suite.Require().NoError(err)
+	suite.Require().NoError(method.SendAndReceive())
+	suite.True(cleaned)
+	suite.Contains(output.String(), "Needs-Cleanup: true\n")
+	suite.Contains(output.String(), "201 URI Done\nFilename: /tmp/Release\n")
+	suite.Contains(output.String(), "201 URI Done\nFilename: /tmp/InRelease\n")
+}
+
+func (suite *ShutdownSuite) TestCleanupAfterHandshakeFailure() {
+	cleaned := false
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(""), io.Discard)),
+		WithCleanup(func() error {
+			cleaned = true
+			return nil
+		}))
+	suite.Require().NoError(err)
+	suite.Error(method.SendAndReceive())
+	suite.True(cleaned)
+	select {
+	case <-method.stopped:
+	default:
+		suite.Fail("method was not stopped")
+	}
+}
+
+func (suite *ShutdownSuite) TestShutdownAbandonsRequests() {
+	reader, input := io.Pipe()
+	defer input.Close()
+	output := strings.Builder{}
+	started := make(chan struct{})
+	written := make(chan error, 1)
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(reader, &output)),
+		WithConcurrencyLimit(1),
+		WithHandlerFunction(func(writer *MessageWriter, request *Request) error {
+			close(started)
+			<-request.Context().Done()
+			time.Sleep(10 * time.Millisecond)
+			message, _ := MarshalMessage(&URIDone{URI: requestURI(request)})
+			written <- writer.Write(message)
+			return nil
+		}))
+	suite.Require().NoError(err)
+	result := make(chan error, 1)
+	go func() { result <- method.SendAndReceive() }()
+	go io.WriteString(input, shutdownInput)
+	<-started
+	suite.Eventually(func() bool { return method.QueueStats().Length == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	suite.ErrorIs(method.Shutdown(ctx), ErrRequestsAbandoned)
+	suite.ErrorIs(<-result, ErrMethodShutdown)
+	suite.ErrorIs(<-written, ErrMethodShutdown)
+	suite.Contains(output.String(), heredoc.Doc(`
+    400 URI Failure
+    Message: transport method is shutting down
+    Uri: s3://bucket/InRelease
+  `))
+	suite.Contains(output.String(), heredoc.Doc(`
+    400 URI Failure
+    Message: transport method was shut down before the request finished
+    Uri: s3://bucket/Release
+  `))
+	suite.NotContains(output.String(), "201 URI Done")
+	suite.ErrorIs(method.Shutdown(context.Background()), ErrRequestsAbandoned)
+}
+
+func (suite *ShutdownSuite) TestContextCancelled() {
+	reader, input := io.Pipe()
+	defer input.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	method, err := NewMethod(ctx, "1.0",
+		WithStream(NewStreamWith(reader, io.Discard)),
+		WithHandlerFunction(func(*MessageWriter, *Request) error { return nil }))
+	suite.Require().NoError(err)
+	result := make(chan error, 1)
+	go func() { result <- method.SendAndReceive() }()
+	_, err = io.WriteString(input, "601 Configuration\n\n")
+	suite.Require().NoError(err)
+	cancel()
+	select {
+	case err := <-result:
+		suite.ErrorIs(err, context.Canceled)
+	case <-time.After(time.Second):
+		suite.Fail("method did not stop")
+	}
+}
+
+func TestShutdown(test *testing.T) {
+	suite.Run(test, new(ShutdownSuite))
+}
@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// stdoutGuard owns the pipe that file descriptor 1 points at while the guard
+// is installed, and forwards whatever is written to it as messages.
+type stdoutGuard struct {
+	stdout *os.File
+	reader *os.File
+	writer *os.File
+	// stream is the stream that was switched to the private standard output,
+	// if any, and output serializes the writes to it.
+	stream *Stream
+	output *syncWriter
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// WithStdoutGuard protects the stream from anything else in the process that
+// writes to standard output, such as a stray fmt.Println or a noisy
+// dependency. Without it, such writes are read by APT as malformed messages.
+//
+// The real standard output is moved to a private file descriptor, which the
+// [Stream] of the Method writes to if it was writing to [os.Stdout], and file
+// descriptor 1 is pointed at a pipe. Each line written to the pipe is sent to
+// APT as a message with the given status code, which must be either
+// [StatusCodeLog] or [StatusCodeWarning]. The guard is installed when
+// [Method.SendAndReceive] is called, and standard output is restored before
+// it returns, once the Method has shut down.
+//
+// The guard is only supported on Unix systems. On other systems,
+// SendAndReceive returns [ErrStdoutGuardUnsupported].
+func WithStdoutGuard(statusCode int) MethodOption {
+	return func(method *Method) error {
+		if statusCode != StatusCodeLog && statusCode != StatusCodeWarning {
+			return fmt.Errorf("stdout guard cannot send status code %d", statusCode)
+		}
+		method.stdoutStatusCode = statusCode
+		return nil
+	}
+}
+
+// guardStdout installs the stdout guard, if it was asked for with
+// [WithStdoutGuard], and starts forwarding what is written to it. It returns
+// a nil guard otherwise.
+func (method *Method) guardStdout() (*stdoutGuard, error) {
+	if method.stdoutStatusCode == 0 {
+		return nil, nil
+	}
+	guard, err := newStdoutGuard()
+	if err != nil {
+		return nil, err
+	}
+	if method.stream.output == os.Stdout {
+		method.stream.output = guard.stdout
+		guard.stream, guard.output = method.stream, method.output
+	}
+	go guard.forward(method.output, method.stdoutStatusCode)
+	return guard, nil
+}
+
+// newStdoutGuard points file descriptor 1 at a new pipe.
+func newStdoutGuard() (*stdoutGuard, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := redirectStdout(writer)
+	if err != nil {
+		reader.Close()
+		writer.Close()
+		return nil, err
+	}
+	return &stdoutGuard{
+		stdout: stdout,
+		reader: reader,
+		writer: writer,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// forward sends each line written to the pipe to the writer, until the pipe
+// is closed by restore.
+func (guard *stdoutGuard) forward(output io.Writer, statusCode int) {
+	defer close(guard.done)
+	writer := NewMessageWriter(output)
+	reader := bufio.NewReader(guard.reader)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			var message *Message
+			if statusCode == StatusCodeWarning {
+				message, _ = Warning(line).MarshalMessage()
+			} else {
+				message, _ = Log(line).MarshalMessage()
+			}
+			writer.Write(message)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// restore points file descriptor 1 back at the real standard output, waits
+// for anything left in the pipe to be forwarded, and then switches the stream
+// back to [os.Stdout] and closes the private descriptor. It is safe to call on
+// a nil guard.
+func (guard *stdoutGuard) restore() error {
+	if guard == nil {
+		return nil
+	}
+	guard.once.Do(func() {
+		guard.err = restoreStdout(guard.stdout)
+		guard.writer.Close()
+		<-guard.done
+		guard.reader.Close()
+		if guard.stream != nil {
+			guard.output.mutex.Lock()
+			guard.stream.output = os.Stdout
+			guard.output.mutex.Unlock()
+		}
+		guard.err = errors.Join(guard.err, guard.stdout.Close())
+	})
+	return guard.err
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package transport
+
+import "os"
+
+func redirectStdout(*os.File) (*os.File, error) {
+	return nil, ErrStdoutGuardUnsupported
+}
+
+func restoreStdout(*os.File) error {
+	return ErrStdoutGuardUnsupported
+}
@@ -0,0 +1,93 @@
+//go:build unix
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type StdoutGuardSuite struct {
+	suite.Suite
+}
+
+func (suite *StdoutGuardSuite) next(recorder messageRecorder) string {
+	select {
+	case message := <-recorder:
+		return message
+	case <-time.After(time.Second):
+		suite.FailNow("no message was sent")
+		return ""
+	}
+}
+
+func (suite *StdoutGuardSuite) TestForward() {
+	input, toMethod := io.Pipe()
+	recorder := make(messageRecorder, 10)
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(input, recorder)),
+		WithStdoutGuard(StatusCodeWarning))
+	suite.Require().NoError(err)
+	returned := make(chan error, 1)
+	go func() { returned <- method.SendAndReceive() }()
+	suite.Contains(suite.next(recorder), "100 Capabilities\n")
+	io.WriteString(toMethod, "601 Configuration\n\n")
+	fmt.Println("noisy dependency")
+	suite.Equal("104 Warning\nMessage: noisy dependency\n\n", suite.next(recorder))
+	fmt.Print("unterminated")
+	toMethod.Close()
+	suite.NoError(<-returned)
+	// What is left in the pipe is forwarded before SendAndReceive returns.
+	suite.Equal("104 Warning\nMessage: unterminated\n\n", suite.next(recorder))
+	suite.Empty(recorder)
+}
+
+func (suite *StdoutGuardSuite) TestRestoreAfterHandshakeFailure() {
+	recorder := make(messageRecorder, 10)
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(""), recorder)),
+		WithStdoutGuard(StatusCodeLog))
+	suite.Require().NoError(err)
+	var guarded os.FileInfo
+	method.cleanups = append(method.cleanups, func() error {
+		guarded, err = os.Stdout.Stat()
+		return err
+	})
+	suite.Error(method.SendAndReceive())
+	suite.Require().NotNil(guarded)
+	suite.Equal(os.ModeNamedPipe, guarded.Mode().Type())
+	restored, err := os.Stdout.Stat()
+	suite.Require().NoError(err)
+	suite.False(os.SameFile(guarded, restored))
+}
+
+func (suite *StdoutGuardSuite) TestPrivateStdout() {
+	method, err := NewMethod(context.Background(), "1.0", WithStdoutGuard(StatusCodeLog))
+	suite.Require().NoError(err)
+	guard, err := method.guardStdout()
+	suite.Require().NoError(err)
+	suite.NotSame(os.Stdout, method.stream.output)
+	suite.Same(guard.stdout, method.stream.output)
+	suite.NoError(guard.restore())
+	suite.NoError(guard.restore())
+	suite.Same(os.Stdout, method.stream.output)
+	// The private descriptor is closed.
+	_, err = guard.stdout.Stat()
+	suite.ErrorIs(err, os.ErrClosed)
+}
+
+func (suite *StdoutGuardSuite) TestInvalidStatusCode() {
+	_, err := NewMethod(context.Background(), "1.0", WithStdoutGuard(StatusCodeStatus))
+	suite.Error(err)
+}
+
+func TestStdoutGuard(test *testing.T) {
+	suite.Run(test, new(StdoutGuardSuite))
+}
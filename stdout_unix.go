@@ -0,0 +1,31 @@
+//go:build unix
+
+package transport
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// redirectStdout duplicates file descriptor 1 to a private descriptor, which
+// is returned, and then points file descriptor 1 at the file.
+func redirectStdout(file *os.File) (*os.File, error) {
+	fd, err := unix.Dup(unix.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	unix.CloseOnExec(fd)
+	if err := unix.Dup2(int(file.Fd()), unix.Stdout); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "/dev/stdout"), nil
+}
+
+// restoreStdout points file descriptor 1 back at the private descriptor
+// returned by redirectStdout. The private descriptor is left open, for the
+// caller to close once nothing writes to it anymore.
+func restoreStdout(stdout *os.File) error {
+	return unix.Dup2(int(stdout.Fd()), unix.Stdout)
+}
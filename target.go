@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TargetFile writes the target file of a request atomically, hashing its
+// contents as they are written.
+//
+// The contents are written to a temporary file in the same directory as the
+// target, which only replaces the target once [TargetFile.Commit] is called.
+// Closing a TargetFile that was not committed removes the temporary file, so
+// a failed transfer never leaves a partial target behind:
+//
+//	target, err := writer.CreateTarget()
+//	if err != nil {
+//		return err
+//	}
+//	defer target.Close()
+//	if _, err := io.Copy(target, body); err != nil {
+//		return err
+//	}
+//	return target.Commit()
+type TargetFile struct {
+	writer   *MessageWriter
+	file     *os.File
+	path     string
+	output   io.Writer
+	md5      hash.Hash
+	sha1     hash.Hash
+	sha256   hash.Hash
+	sha512   hash.Hash
+	size     int64
+	modified time.Time
+	done     bool
+}
+
+// CreateTarget creates a [TargetFile] for the target of the request the
+// writer was given for.
+func (writer *MessageWriter) CreateTarget() (*TargetFile, error) {
+	if writer.request == nil || writer.request.Target == "" {
+		return nil, ErrNoTarget
+	}
+	path := writer.request.Target
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	target := &TargetFile{
+		writer: writer,
+		file:   file,
+		path:   path,
+		md5:    md5.New(),
+		sha1:   sha1.New(),
+		sha256: sha256.New(),
+		sha512: sha512.New(),
+	}
+	target.output = io.MultiWriter(file, target.md5, target.sha1, target.sha256, target.sha512)
+	return target, nil
+}
+
+// Write writes the data to the temporary file, and adds it to the hashes.
+func (target *TargetFile) Write(data []byte) (int, error) {
+	if target.done {
+		return 0, os.ErrClosed
+	}
+	count, err := target.output.Write(data)
+	target.size += int64(count)
+	return count, err
+}
+
+// SetModified sets the modification time of the resource, which is kept as
+// the modification time of the target file, and sent as the Last-Modified of
+// the 201 URI Done.
+func (target *TargetFile) SetModified(modified time.Time) {
+	target.modified = modified
+}
+
+// Name returns the name of the temporary file being written.
+func (target *TargetFile) Name() string {
+	return target.file.Name()
+}
+
+// Commit syncs the temporary file to disk and renames it to the target. The
+// size and hashes of the file (and its modification time, if set) are used
+// for the 201 URI Done the [Method] sends once the handler returns.
+//
+// If Commit fails, the temporary file is removed.
+func (target *TargetFile) Commit() error {
+	if target.done {
+		return os.ErrClosed
+	}
+	target.done = true
+	err := target.file.Chmod(0o644)
+	err = errors.Join(err, target.file.Sync())
+	err = errors.Join(err, target.file.Close())
+	if err == nil && !target.modified.IsZero() {
+		err = os.Chtimes(target.file.Name(), target.modified, target.modified)
+	}
+	if err == nil {
+		err = os.Rename(target.file.Name(), target.path)
+	}
+	if err != nil {
+		os.Remove(target.file.Name())
+		return err
+	}
+	target.writer.updateDone(func(done *URIDone) {
+		done.Filename = target.path
+		done.Size = target.size
+		done.MD5Hash = hex.EncodeToString(target.md5.Sum(nil))
+		done.MD5SumHash = done.MD5Hash
+		done.SHA1Hash = hex.EncodeToString(target.sha1.Sum(nil))
+		done.SHA256Hash = hex.EncodeToString(target.sha256.Sum(nil))
+		done.SHA512Hash = hex.EncodeToString(target.sha512.Sum(nil))
+		if !target.modified.IsZero() {
+			done.LastModified = formatTime(target.modified)
+		}
+	})
+	return nil
+}
+
+// Close removes the temporary file, unless the TargetFile was committed. It
+// is safe to call Close more than once.
+func (target *TargetFile) Close() error {
+	if target.done {
+		return nil
+	}
+	target.done = true
+	return errors.Join(target.file.Close(), os.Remove(target.file.Name()))
+}
@@ -0,0 +1,81 @@
+package transport
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TargetFileSuite struct {
+	suite.Suite
+}
+
+func (suite *TargetFileSuite) newWriter() (*MessageWriter, string) {
+	writer := NewMessageWriter(io.Discard)
+	writer.request = newTestRequest()
+	writer.request.Target = filepath.Join(suite.T().TempDir(), "Release")
+	return writer, writer.request.Target
+}
+
+func (suite *TargetFileSuite) TestCommit() {
+	writer, path := suite.newWriter()
+	target, err := writer.CreateTarget()
+	suite.Require().NoError(err)
+	defer target.Close()
+	modified := time.Date(2024, time.March, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	target.SetModified(modified)
+	_, err = io.Copy(target, strings.NewReader("hello world"))
+	suite.Require().NoError(err)
+	suite.NoFileExists(path)
+	suite.Require().NoError(target.Commit())
+	suite.NoError(target.Close())
+
+	content, err := os.ReadFile(path)
+	suite.Require().NoError(err)
+	suite.Equal("hello world", string(content))
+	info, err := os.Stat(path)
+	suite.Require().NoError(err)
+	suite.True(modified.Equal(info.ModTime()))
+	suite.Equal(URIDone{
+		Filename:     path,
+		LastModified: "Fri, 01 Mar 2024 11:30:00 GMT",
+		MD5Hash:      "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		MD5SumHash:   "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		SHA1Hash:     "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed",
+		SHA256Hash:   "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		SHA512Hash:   "309ecc489c12d6eb4cc40f50c902f2b4d0ed77ee511a7c7a9bcd3ca86d4cd86f989dd35bc5ff499670da34255b45b0cfd830e81f605dcf7dc5542e93ae9cd76f",
+		Size:         11,
+	}, writer.uriDone())
+}
+
+func (suite *TargetFileSuite) TestClose() {
+	writer, path := suite.newWriter()
+	target, err := writer.CreateTarget()
+	suite.Require().NoError(err)
+	_, err = target.Write([]byte("partial"))
+	suite.Require().NoError(err)
+	suite.FileExists(target.Name())
+	suite.NoError(target.Close())
+	suite.NoError(target.Close())
+	suite.NoFileExists(target.Name())
+	suite.NoFileExists(path)
+	suite.ErrorIs(target.Commit(), os.ErrClosed)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	suite.Require().NoError(err)
+	suite.Empty(entries)
+	suite.Equal(URIDone{}, writer.uriDone())
+}
+
+func (suite *TargetFileSuite) TestNoTarget() {
+	_, err := NewMessageWriter(io.Discard).CreateTarget()
+	suite.ErrorIs(err, ErrNoTarget)
+}
+
+func TestTargetFile(test *testing.T) {
+	suite.Run(test, new(TargetFileSuite))
+}
@@ -1,14 +1,73 @@
 package transport
 
 import (
+	"context"
+	"os"
 	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
-var tracer = otel.Tracer("occult.work/apt/transport")
+const instrumentationName = "occult.work/apt/transport"
+
+var tracer = otel.Tracer(instrumentationName)
+
+// TraceParentKey and TraceStateKey are the configuration keys a parent trace
+// context may be passed in with (e.g.,
+// "apt-get -o Acquire::Trace::Parent=00-...-01 update"), in the W3C Trace
+// Context format. They are used when the TRACEPARENT and TRACESTATE
+// environment variables are not set.
+const (
+	TraceParentKey = "Acquire::Trace::Parent"
+	TraceStateKey  = "Acquire::Trace::State"
+)
+
+// WithTracerProvider sets the provider of the tracer used by the [Method]. By
+// default, the global provider (see [otel.SetTracerProvider]) is used.
+//
+// A Method records a span for each call to [Method.SendAndReceive], with child
+// spans for the handshake and for each acquire, which in turn has a child span
+// for each message written by its handler. The span of an acquire is carried
+// by [Request.Context], so that handlers may add their own child spans.
+func WithTracerProvider(provider trace.TracerProvider) MethodOption {
+	return func(method *Method) error {
+		method.tracer = provider.Tracer(instrumentationName)
+		return nil
+	}
+}
+
+// traceParent returns the context the Method's root span is started in. A
+// span already carried by ctx takes precedence, followed by the TRACEPARENT
+// environment variable, and then the configuration.
+func traceParent(ctx context.Context, cfg Configuration) context.Context {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	carrier := propagation.MapCarrier{}
+	if parent := os.Getenv("TRACEPARENT"); parent != "" {
+		carrier.Set("traceparent", parent)
+		carrier.Set("tracestate", os.Getenv("TRACESTATE"))
+	} else if parent := cfg.Get(TraceParentKey); parent != "" {
+		carrier.Set("traceparent", parent)
+		carrier.Set("tracestate", cfg.Get(TraceStateKey))
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// traceHandshake records the handshake, which happens before the root span
+// can be started, as the configuration may carry the trace parent.
+func (method *Method) traceHandshake(ctx context.Context, started time.Time, err error) {
+	_, span := method.tracer.Start(ctx, "apt.handshake", trace.WithTimestamp(started))
+	span.SetAttributes(
+		attribute.Int("apt.configuration.items", len(method.config())),
+		attribute.Bool("apt.capabilities.pipeline", method.capabilities.Pipeline),
+	)
+	endSpan(span, err)
+}
 
 func setSpanRequest(span trace.Span, request *Request) {
 	span.SetAttributes(
@@ -17,3 +76,12 @@ func setSpanRequest(span trace.Span, request *Request) {
 		attribute.String("request.target", request.Target),
 	)
 }
+
+// endSpan records err (if any) on the span, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
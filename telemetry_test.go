@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type TelemetrySuite struct {
+	suite.Suite
+}
+
+const (
+	telemetryTraceID    = "4bf92f3577b34da6a3ce929d0e0e4736"
+	telemetryParent     = "00-" + telemetryTraceID + "-00f067aa0ba902b7-01"
+	telemetryOtherTrace = "0af7651916cd43dd8448eb211c80319c"
+)
+
+func (suite *TelemetrySuite) run(input string) map[string]sdktrace.ReadOnlySpan {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	method, err := NewMethod(context.Background(), "1.0",
+		WithStream(NewStreamWith(strings.NewReader(input), &strings.Builder{})),
+		WithTracerProvider(provider),
+		WithHandlerFunction(func(writer *MessageWriter, request *Request) error {
+			writer.Status("Connecting to bucket")
+			return errors.New("no such object")
+		}))
+	suite.Require().NoError(err)
+	suite.Require().NoError(method.SendAndReceive())
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	return spans
+}
+
+func (suite *TelemetrySuite) TestSpans() {
+	suite.T().Setenv("TRACEPARENT", "")
+	spans := suite.run(heredoc.Doc(`
+    601 Configuration
+    Config-Item: Acquire::Trace::Parent=` + telemetryParent + `
+
+    600 URI Acquire
+    URI: s3://bucket/Release
+    Filename: /tmp/Release
+
+  `))
+	suite.Require().Contains(spans, "apt.method")
+	suite.Require().Contains(spans, "apt.handshake")
+	suite.Require().Contains(spans, "apt.acquire")
+	suite.Require().Contains(spans, "apt.write")
+
+	root := spans["apt.method"]
+	suite.Equal(telemetryTraceID, root.SpanContext().TraceID().String())
+	suite.Equal("00f067aa0ba902b7", root.Parent().SpanID().String())
+	suite.Equal(root.SpanContext().SpanID(), spans["apt.handshake"].Parent().SpanID())
+
+	acquire := spans["apt.acquire"]
+	suite.Equal(root.SpanContext().SpanID(), acquire.Parent().SpanID())
+	suite.Contains(acquire.Attributes(), attribute.String("request.source", "s3://bucket/Release"))
+	suite.Equal(codes.Error, acquire.Status().Code)
+	suite.Equal("no such object", acquire.Status().Description)
+
+	write := spans["apt.write"]
+	suite.Equal(acquire.SpanContext().SpanID(), write.Parent().SpanID())
+}
+
+func (suite *TelemetrySuite) TestEnvironmentParent() {
+	suite.T().Setenv("TRACEPARENT", "00-"+telemetryOtherTrace+"-00f067aa0ba902b7-01")
+	spans := suite.run(heredoc.Doc(`
+    601 Configuration
+    Config-Item: Acquire::Trace::Parent=` + telemetryParent + `
+
+  `))
+	suite.Require().Contains(spans, "apt.method")
+	suite.Equal(telemetryOtherTrace, spans["apt.method"].SpanContext().TraceID().String())
+}
+
+func TestTelemetry(test *testing.T) {
+	suite.Run(test, new(TelemetrySuite))
+}
@@ -27,6 +27,10 @@ type URIStart struct {
 // found in the local pathname space. This is done if a decompressed version of
 // a gunzip file is found.
 //
+// The hash fields carry the hashes of the file, which APT compares with the
+// hashes it expects. MD5-Hash is the older name of MD5Sum-Hash, and both are
+// still read by APT.
+//
 // BUG(bruxisma): We do not currently support the Alt- prefixed fields.
 type URIDone struct {
 	URI          string
@@ -34,6 +38,10 @@ type URIDone struct {
 	IMSHit       string `transport:"IMS-Hit"`
 	Filename     string
 	MD5Hash      string `transport:"MD5-Hash"`
+	MD5SumHash   string `transport:"MD5Sum-Hash"`
+	SHA1Hash     string `transport:"SHA1-Hash"`
+	SHA256Hash   string `transport:"SHA256-Hash"`
+	SHA512Hash   string `transport:"SHA512-Hash"`
 	Size         int64
 }
 
@@ -42,9 +50,16 @@ type URIDone struct {
 //
 // Indicates a fatal URI failure. As with 201 URI Done, 200 URI start is not
 // required to precede this message.
+//
+// [transport.URIFailure.Transient] tells APT the failure may go away, so that
+// it may retry the URI later. [transport.URIFailure.FailReason] is a short
+// machine readable reason (e.g., "Timeout" or "HashSumMismatch") that APT
+// uses to decide how to handle the failure.
 type URIFailure struct {
-	URI     string
-	Message string
+	URI        string
+	Message    string
+	FailReason string `transport:"FailReason"`
+	Transient  bool   `transport:"Transient-Failure"`
 }
 
 // URIAcquire (status code 600) indicates that APT is requesting a new URI be
@@ -64,6 +79,49 @@ type URIAcquire struct {
 	Filename     string
 }
 
+func (start *URIStart) MarshalMessage() (*Message, error) {
+	fields, err := MarshalFields(start)
+	if err != nil {
+		return nil, err
+	}
+	message := &Message{
+		StatusCode: StatusCodeURIStart,
+		Summary:    "URI Start",
+		Fields:     fields,
+	}
+	return message, nil
+}
+
+func (done *URIDone) MarshalMessage() (*Message, error) {
+	fields, err := MarshalFields(done)
+	if err != nil {
+		return nil, err
+	}
+	message := &Message{
+		StatusCode: StatusCodeURIDone,
+		Summary:    "URI Done",
+		Fields:     fields,
+	}
+	return message, nil
+}
+
+func (failure *URIFailure) MarshalMessage() (*Message, error) {
+	fields, err := MarshalFields(failure)
+	if err != nil {
+		return nil, err
+	}
+	// APT only looks for the field when the failure is transient.
+	if !failure.Transient {
+		fields.Del("Transient-Failure")
+	}
+	message := &Message{
+		StatusCode: StatusCodeURIFailure,
+		Summary:    "URI Failure",
+		Fields:     fields,
+	}
+	return message, nil
+}
+
 func (failure *URIFailure) Error() string {
 	return fmt.Sprintf("failure acquiring uri %q: %s", failure.URI, failure.Message)
 }
@@ -0,0 +1,157 @@
+package transport
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// HashSumMismatch is the FailReason of the [URIFailure] sent when the target
+// does not have the hashes APT expects.
+const HashSumMismatch = "HashSumMismatch"
+
+// expectedHash pairs a hash APT expects with the field of the 201 URI Done
+// that carries the actual hash.
+type expectedHash struct {
+	name     string
+	expected string
+	actual   *string
+	create   func() hash.Hash
+}
+
+// SkipHashVerification returns a middleware that turns off the verification
+// of the target against the Expected-* hashes sent by APT, for the handlers
+// it wraps. This is useful for handlers that verify the hashes themselves, or
+// that cannot produce the target file APT asked for. APT still verifies the
+// file itself.
+func SkipHashVerification() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(writer *MessageWriter, request *Request) error {
+			writer.mutex.Lock()
+			writer.skipHashes = true
+			writer.mutex.Unlock()
+			return next.AcquireResource(writer, request)
+		})
+	}
+}
+
+// verifyDone verifies the target of a 201 URI Done that is about to be
+// written. It returns the message to write instead: a copy with the hashes
+// that had to be computed filled in, or a 400 URI Failure together with the
+// mismatch. If the failure cannot be marshalled, the message is nil.
+func (writer *MessageWriter) verifyDone(message *Message) (*Message, error) {
+	done := URIDone{}
+	if err := UnmarshalFields(message.Fields, &done); err != nil {
+		return message, nil
+	}
+	if done.Filename == "" {
+		done.Filename = writer.request.Target
+	}
+	if err := writer.verifyHashes(writer.request, &done); err != nil {
+		failure, marshalErr := MarshalMessage(newFailureMessage(writer.request, err))
+		if marshalErr != nil {
+			return nil, marshalErr
+		}
+		return failure, err
+	}
+	verified := &Message{StatusCode: message.StatusCode, Summary: message.Summary, Fields: Fields{}}
+	for key, values := range message.Fields {
+		verified.Fields[key] = values
+	}
+	for key, value := range map[string]string{
+		"MD5-Hash":    done.MD5Hash,
+		"MD5Sum-Hash": done.MD5SumHash,
+		"SHA1-Hash":   done.SHA1Hash,
+		"SHA256-Hash": done.SHA256Hash,
+		"SHA512-Hash": done.SHA512Hash,
+	} {
+		if value != "" && verified.Fields.Get(key) == "" {
+			verified.Fields.Set(key, value)
+		}
+	}
+	return verified, nil
+}
+
+// verifyHashes checks the target against the hashes the request expects.
+// Hashes that are missing from the 201 URI Done (e.g., because the handler
+// did not use a [TargetFile]) are computed from the file, and filled in. A
+// mismatch is returned as a [URIFailure] with a FailReason of
+// [HashSumMismatch].
+func (writer *MessageWriter) verifyHashes(request *Request, done *URIDone) error {
+	writer.mutex.Lock()
+	skip := writer.skipHashes
+	writer.mutex.Unlock()
+	// An IMS hit has no file to verify.
+	if skip || done.IMSHit == "true" {
+		return nil
+	}
+	hashes := []expectedHash{
+		{"MD5Sum", request.ExpectedMD5Sum, &done.MD5SumHash, md5.New},
+		{"SHA1", request.ExpectedSHA1, &done.SHA1Hash, sha1.New},
+		{"SHA256", request.ExpectedSHA256, &done.SHA256Hash, sha256.New},
+		{"SHA512", request.ExpectedSHA512, &done.SHA512Hash, sha512.New},
+	}
+	missing := map[*string]hash.Hash{}
+	expected := false
+	for _, entry := range hashes {
+		if entry.expected == "" {
+			continue
+		}
+		expected = true
+		if *entry.actual == "" {
+			missing[entry.actual] = entry.create()
+		}
+	}
+	if !expected {
+		return nil
+	}
+	if len(missing) != 0 {
+		if err := hashFile(done.Filename, missing); err != nil {
+			return fmt.Errorf("cannot verify hashes: %w", err)
+		}
+		if done.MD5Hash == "" {
+			done.MD5Hash = done.MD5SumHash
+		}
+	}
+	var mismatches []string
+	for _, entry := range hashes {
+		if entry.expected != "" && !strings.EqualFold(entry.expected, *entry.actual) {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %s, expected %s", entry.name, *entry.actual, entry.expected))
+		}
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	return &URIFailure{
+		Message:    "Hash Sum mismatch: " + strings.Join(mismatches, "; "),
+		FailReason: HashSumMismatch,
+	}
+}
+
+// hashFile computes the given hashes of the file, and stores them as
+// hexadecimal strings.
+func hashFile(path string, hashes map[*string]hash.Hash) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writers := make([]io.Writer, 0, len(hashes))
+	for _, hash := range hashes {
+		writers = append(writers, hash)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return err
+	}
+	for actual, hash := range hashes {
+		*actual = hex.EncodeToString(hash.Sum(nil))
+	}
+	return nil
+}
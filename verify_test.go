@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const helloWorldSHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+type VerifySuite struct {
+	suite.Suite
+}
+
+// writeTarget writes the target, leaving the 201 URI Done to the Method.
+func writeTarget(writer *MessageWriter, request *Request) error {
+	return os.WriteFile(request.Target, []byte("hello world"), 0o644)
+}
+
+// serve runs the handler for a request that expects the given SHA256 hash,
+// and returns the message sent once it finished.
+func (suite *VerifySuite) serve(expected string, handler HandlerFunc, middlewares ...Middleware) string {
+	method, recorder := newRecordedMethod(suite.T(),
+		WithMiddleware(middlewares...),
+		WithHandlerFunction(handler))
+	message := &Message{StatusCode: StatusCodeURIAcquire, Summary: "URI Acquire", Fields: Fields{}}
+	message.Fields.Set("URI", "s3://bucket/Release")
+	message.Fields.Set("Filename", filepath.Join(suite.T().TempDir(), "Release"))
+	message.Fields.Set("Expected-SHA256", expected)
+	request := &Request{}
+	suite.Require().NoError(UnmarshalMessage(message, request))
+	suite.Equal(expected, request.ExpectedSHA256)
+	method.serve(request)
+	return <-recorder
+}
+
+func (suite *VerifySuite) TestMatch() {
+	message := suite.serve(helloWorldSHA256, writeTarget)
+	suite.Contains(message, "201 URI Done\n")
+	suite.Contains(message, "\nSha256-Hash: "+helloWorldSHA256+"\n")
+}
+
+func (suite *VerifySuite) TestMismatch() {
+	message := suite.serve("0123456789abcdef", writeTarget)
+	suite.Contains(message, "400 URI Failure\n")
+	suite.Contains(message, "\nFailreason: HashSumMismatch\n")
+	suite.Contains(message, "\nMessage: Hash Sum mismatch: SHA256 is "+helloWorldSHA256+", expected 0123456789abcdef\n")
+}
+
+func (suite *VerifySuite) TestSkip() {
+	message := suite.serve("0123456789abcdef", writeTarget, SkipHashVerification())
+	suite.Contains(message, "201 URI Done\n")
+	suite.NotContains(message, "Sha256-Hash")
+}
+
+func (suite *VerifySuite) TestHandlerSentDone() {
+	written := make(chan error, 1)
+	sendDone := func(writer *MessageWriter, request *Request) error {
+		if err := writeTarget(writer, request); err != nil {
+			return err
+		}
+		message, err := (&URIDone{URI: requestURI(request), Filename: request.Target, Size: 11}).MarshalMessage()
+		if err != nil {
+			return err
+		}
+		err = writer.Write(message)
+		written <- err
+		return err
+	}
+	message := suite.serve(helloWorldSHA256, sendDone)
+	suite.NoError(<-written)
+	suite.Contains(message, "201 URI Done\n")
+	suite.Contains(message, "\nSha256-Hash: "+helloWorldSHA256+"\n")
+
+	message = suite.serve("0123456789abcdef", sendDone)
+	suite.ErrorIs(<-written, &URIFailure{})
+	suite.Contains(message, "400 URI Failure\n")
+	suite.Contains(message, "\nFailreason: HashSumMismatch\n")
+}
+
+func (suite *VerifySuite) TestMissingFile() {
+	writer := NewMessageWriter(nil)
+	done := &URIDone{Filename: filepath.Join(suite.T().TempDir(), "missing")}
+	err := writer.verifyHashes(&Request{ExpectedSHA1: "abc"}, done)
+	suite.ErrorIs(err, os.ErrNotExist)
+	suite.NoError(writer.verifyHashes(&Request{ExpectedSHA1: "abc"}, &URIDone{IMSHit: "true"}))
+	suite.NoError(writer.verifyHashes(&Request{}, done))
+}
+
+func TestVerify(test *testing.T) {
+	suite.Run(test, new(VerifySuite))
+}
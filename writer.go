@@ -1,8 +1,13 @@
 package transport
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MessageWriter is used to send additional messages back to the consumer.
@@ -10,27 +15,138 @@ import (
 // These messages are sent immediately once called, and can result in a handler
 // being cancelled if an error is sent.
 type MessageWriter struct {
+	inner         io.Writer
+	configuration Configuration
+	media         *mediaCoordinator
+	authorization *authorizationBroker
+	aux           *auxBroker
+	request       *Request
+	ctx           context.Context
+	metrics       *methodMetrics
+	mutex         sync.Mutex
+	finished      int
+	closed        bool
+	done          URIDone
+	skipHashes    bool
+}
+
+// syncWriter serializes writes to the underlying writer, so that messages
+// written by concurrent handlers are never interleaved.
+type syncWriter struct {
+	mutex sync.Mutex
 	inner io.Writer
 }
 
 func NewMessageWriter(writer io.Writer) *MessageWriter {
-	return &MessageWriter{writer}
+	return &MessageWriter{inner: writer}
 }
 
 // Configuration returns a copy of configuration sent to the Method from APT.
+//
+// MessageWriters that were not created by a [Method] have an empty
+// configuration.
 func (writer *MessageWriter) Configuration() Configuration {
-	return Configuration{}
+	return writer.configuration.Clone()
 }
 
 // Write attempts to marshal the provided message into a binary wire format,
 // and then write it all at once to the underlying writer.
-func (writer *MessageWriter) Write(message *Message) error {
+//
+// Writing a message is a safe point (see [MessageWriter.Checkpoint]), so Write
+// blocks while another handler is waiting for media.
+//
+// When the writer was given to a Handler by a [Method], each write is
+// recorded as a child span of the request's span.
+//
+// A 201 URI Done for the request the writer was given for is first verified
+// against the hashes APT expects (see [SkipHashVerification]). On a mismatch,
+// a 400 URI Failure is written instead, and returned as the error.
+func (writer *MessageWriter) Write(message *Message) (err error) {
+	if writer.ctx != nil {
+		_, span := trace.SpanFromContext(writer.ctx).TracerProvider().Tracer(instrumentationName).Start(writer.ctx, "apt.write",
+			trace.WithAttributes(attribute.Int("apt.message.status_code", message.StatusCode)))
+		defer func() { endSpan(span, err) }()
+	}
+	var failure error
+	if message.StatusCode == StatusCodeURIDone && writer.request != nil {
+		if message, failure = writer.verifyDone(message); message == nil {
+			return failure
+		}
+	}
 	data, err := message.MarshalBinary()
 	if err != nil {
 		return err
 	}
+	writer.Checkpoint(context.Background())
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if writer.closed {
+		return ErrMethodShutdown
+	}
+	_, err = writer.inner.Write(data)
+	switch message.StatusCode {
+	case StatusCodeURIDone:
+		writer.metrics.recordDone(writer.request, message)
+		fallthrough
+	case StatusCodeURIFailure:
+		writer.finished = message.StatusCode
+	}
+	if err == nil {
+		err = failure
+	}
+	return err
+}
+
+// isFinished reports whether a 201 URI Done or 400 URI Failure was written.
+func (writer *MessageWriter) isFinished() bool {
+	return writer.finishedWith() != 0
+}
+
+// finishedWith returns the status code of the 201 URI Done or 400 URI Failure
+// that was written, or 0 if neither was.
+func (writer *MessageWriter) finishedWith() int {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.finished
+}
+
+// updateDone updates the 201 URI Done the [Method] sends for the request when
+// the handler returns without sending one itself.
+func (writer *MessageWriter) updateDone(update func(*URIDone)) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	update(&writer.done)
+}
+
+// uriDone returns a copy of the 201 URI Done accumulated by updateDone.
+func (writer *MessageWriter) uriDone() URIDone {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.done
+}
+
+// abandon writes the message on behalf of a handler that was abandoned
+// during shutdown, unless the handler already finished. Any later writes are
+// rejected with [ErrMethodShutdown]. It reports whether the message was
+// written.
+func (writer *MessageWriter) abandon(message *Message) bool {
+	data, err := message.MarshalBinary()
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if writer.closed || writer.finished != 0 || err != nil {
+		writer.closed = true
+		return false
+	}
+	writer.closed = true
+	writer.finished = message.StatusCode
 	writer.inner.Write(data)
-	return nil
+	return true
+}
+
+func (writer *syncWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.inner.Write(data)
 }
 
 // Writes a [transport.Warning] message to the communication stream.